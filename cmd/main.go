@@ -17,6 +17,7 @@ func main() {
 	app.Name = "rig"
 	app.Usage = "Containerized platform environment for projects"
 	app.Version = version
+	commands.RigVersion = version
 	app.EnableBashCompletion = true
 
 	app.Flags = []cli.Flag{
@@ -19,6 +19,9 @@ type BaseCommand struct {
 	out     *util.RigLogger
 	machine Machine
 	context *cli.Context
+	// nested is set on commands run as a step of another command, so project
+	// hooks only fire for the command that was typed.
+	nested bool
 }
 
 // Before configure the function to run before all commands to setup core services.
@@ -70,6 +73,14 @@ func (cmd *BaseCommand) Failure(message string, errorName string, exitCode int)
 	return cli.NewExitError(fmt.Sprintf("ERROR: %s [%s] (%d)", message, errorName, exitCode), exitCode)
 }
 
+// Nested copies the command for a delegate command run as part of it, which
+// does not fire project hooks of its own.
+func (cmd *BaseCommand) Nested() BaseCommand {
+	nested := *cmd
+	nested.nested = true
+	return nested
+}
+
 // NewContext creates a new Context struct to pass along to delegate commands
 func (cmd *BaseCommand) NewContext(name string, flags []cli.Flag, parent *cli.Context) *cli.Context {
 	flagSet := flag.NewFlagSet(name, flag.ContinueOnError)
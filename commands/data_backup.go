@@ -39,6 +39,13 @@ func (cmd *DataBackup) Commands() []cli.Command {
 
 // Run executes the `rig data-backup` command
 func (cmd *DataBackup) Run(c *cli.Context) error {
+	return cmd.WithProjectHooks("data-backup", func() error {
+		return cmd.backup(c)
+	})
+}
+
+// backup archives the data directory of the Docker Machine to a local file.
+func (cmd *DataBackup) backup(c *cli.Context) error {
 	if util.SupportsNativeDocker() {
 		return cmd.Success("Data Backup is not needed on Linux, please archive any data directly")
 	}
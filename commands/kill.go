@@ -35,7 +35,7 @@ func (cmd *Kill) Run(c *cli.Context) error {
 	}
 
 	// First stop it (and cleanup)
-	stop := Stop{cmd.BaseCommand}
+	stop := Stop{cmd.Nested()}
 	if err := stop.Run(c); err != nil {
 		return err
 	}
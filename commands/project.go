@@ -11,11 +11,14 @@ import (
 type Project struct {
 	BaseCommand
 	Config *ProjectConfig
+	// unsupported is set when the project configuration requires another
+	// version of rig.
+	unsupported error
 }
 
 // Commands returns the operations supported by this command
 func (cmd *Project) Commands() []cli.Command {
-	cmd.Config = NewProjectConfig()
+	cmd.Config, cmd.unsupported = LoadProjectConfig()
 
 	command := cli.Command{
 		Name:        "project",
@@ -32,6 +35,29 @@ func (cmd *Project) Commands() []cli.Command {
 	sync := ProjectSync{}
 	command.Subcommands = append(command.Subcommands, sync.Commands()...)
 
+	migrate := ProjectMigrate{}
+	command.Subcommands = append(command.Subcommands, migrate.Commands()...)
+
+	list := ProjectList{Config: cmd.Config}
+	command.Subcommands = append(command.Subcommands, list.Commands()...)
+
+	show := ProjectConfigShow{}
+	command.Subcommands = append(command.Subcommands, show.Commands()...)
+
+	docs := ProjectDocs{Config: cmd.Config}
+	command.Subcommands = append(command.Subcommands, docs.Commands()...)
+
+	trust := ProjectTrust{Config: cmd.Config}
+	command.Subcommands = append(command.Subcommands, trust.Commands()...)
+
+	initialize := ProjectInit{}
+	command.Subcommands = append(command.Subcommands, initialize.Commands()...)
+
+	validate := ProjectValidate{}
+	command.Subcommands = append(command.Subcommands, validate.Commands()...)
+	validate.Reserved = command.Subcommands
+	initialize.Reserved = command.Subcommands
+
 	if subcommands := cmd.GetScriptsAsSubcommands(command.Subcommands); subcommands != nil {
 		command.Subcommands = append(command.Subcommands, subcommands...)
 	}
@@ -39,6 +65,19 @@ func (cmd *Project) Commands() []cli.Command {
 	return []cli.Command{command}
 }
 
+// Before stops every project command when the project configuration requires
+// another version of rig.
+func (cmd *Project) Before(c *cli.Context) error {
+	if err := cmd.BaseCommand.Before(c); err != nil {
+		return err
+	}
+	if cmd.unsupported != nil {
+		return cmd.Failure(cmd.unsupported.Error(), "RIG-VERSION-UNSUPPORTED", 12)
+	}
+
+	return nil
+}
+
 // GetScriptsAsSubcommands Processes script configuration into formal subcommands.
 func (cmd *Project) GetScriptsAsSubcommands(otherSubcommands []cli.Command) []cli.Command {
 	cmd.Config.ValidateProjectScripts(otherSubcommands)
@@ -49,19 +88,20 @@ func (cmd *Project) GetScriptsAsSubcommands(otherSubcommands []cli.Command) []cl
 
 	var commands = []cli.Command{}
 	for id, script := range cmd.Config.Scripts {
-		if len(script.Run) > 0 {
+		if len(script.Steps) > 0 {
 			command := cli.Command{
 				Name:        fmt.Sprintf("run:%s", id),
 				Usage:       script.Description,
-				Description: fmt.Sprintf("%s\n\n\tThis command was configured in %s\n\n\tThere are %d steps in this script and any 'extra' arguments will be appended to the final step.", script.Description, cmd.Config.File, len(script.Run)),
+				Description: fmt.Sprintf("%s\n\n\tThis command was configured in %s\n\n\tThere are %d steps in this script and any 'extra' arguments will be appended to the final step.", script.Description, cmd.Config.File, len(script.Steps)),
 				ArgsUsage:   "<args passed to last step>",
+				Flags:       cmd.ScriptArgFlags(script),
 				Category:    "Configured Scripts",
 				Before:      cmd.Before,
 				Action:      cmd.Run,
 			}
 
-			if len(script.Alias) > 0 {
-				command.Aliases = []string{script.Alias}
+			if len(script.Aliases) > 0 {
+				command.Aliases = script.Aliases
 			}
 			command.Description = command.Description + cmd.ScriptRunHelp(script)
 
@@ -85,18 +125,58 @@ func (cmd *Project) Run(c *cli.Context) error {
 		return cmd.Failure(fmt.Sprintf("Unrecognized script '%s'", key), "SCRIPT-NOT-FOUND", 12)
 	}
 
-	scripts := ProjectScript{cmd.out, cmd.Config}
-	if exitCode := scripts.Run(script, c.Args()); exitCode != 0 {
-		return cmd.Failure(fmt.Sprintf("Failure running project script '%s'", key), "COMMAND-ERROR", exitCode)
+	if err := cmd.CheckProjectTrust(cmd.Config); err != nil {
+		return err
+	}
+
+	values := map[string]string{}
+	for _, arg := range script.Args {
+		values[arg.Name] = c.String(arg.Name)
+	}
+
+	scripts := ProjectScript{out: cmd.out, config: cmd.Config}
+	if failure := scripts.Run(script, values, c.Args()); failure != nil {
+		return cmd.Failure(failure.Message, failure.ErrorName, failure.ExitCode)
 	}
 
 	return cmd.Success("")
 }
 
+// ScriptArgFlags converts the named arguments of a script into flags.
+func (cmd *Project) ScriptArgFlags(script *Script) []cli.Flag {
+	flags := []cli.Flag{}
+	for _, arg := range script.Args {
+		usage := arg.Description
+		if len(arg.Choices) > 0 {
+			usage = strings.TrimSpace(fmt.Sprintf("%s (one of: %s)", usage, strings.Join(arg.Choices, ", ")))
+		}
+		if arg.Required {
+			usage = strings.TrimSpace(usage + " (required)")
+		}
+		flags = append(flags, cli.StringFlag{
+			Name:  arg.Name,
+			Usage: usage,
+			Value: arg.Default,
+		})
+	}
+
+	return flags
+}
+
 // ScriptRunHelp generates help details based on script configuration.
 func (cmd *Project) ScriptRunHelp(script *Script) string {
-	help := fmt.Sprintf("\n\nSCRIPT STEPS:\n\t- ")
-	help = help + strings.Join(script.Run, "\n\t- ") + " [args...]\n"
+	help := ""
+	if len(script.Depends) > 0 {
+		help = help + "\n\nDEPENDS ON:\n\t- " + strings.Join(script.Depends, "\n\t- ")
+	}
+	help = help + fmt.Sprintf("\n\nSCRIPT STEPS:\n\t- ")
+	steps := script.StepCommands()
+	for i, step := range steps {
+		if id, _, called := ScriptReference(step); called && cmd.Config.Scripts[id] != nil {
+			steps[i] = strings.TrimSuffix(fmt.Sprintf("%s (calls project script '%s': %s", step, id, cmd.Config.Scripts[id].Description), ": ") + ")"
+		}
+	}
+	help = help + strings.Join(steps, "\n\t- ") + " [args...]\n"
 
 	return help
 }
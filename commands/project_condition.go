@@ -0,0 +1,78 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/phase2/rig/util"
+	"gopkg.in/yaml.v3"
+)
+
+// Condition restricts a script or step to the platforms and situations it
+// applies to. Every condition given must hold.
+type Condition struct {
+	// OS lists the operating systems, as named by Go: linux, darwin or windows.
+	OS StringList
+	// NativeDocker requires Docker to run natively, or in a virtual machine.
+	NativeDocker *bool `yaml:"native_docker"`
+	// Env lists environment variables which must be set to a non-empty value.
+	Env StringList
+	// File lists paths, relative to the project directory, which must exist.
+	File StringList
+}
+
+// StringList is a list of strings which may be given as a single string.
+type StringList []string
+
+// UnmarshalYAML accepts a single string as a list of one.
+func (l *StringList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*l = StringList{value.Value}
+		return nil
+	}
+
+	var list []string
+	if err := value.Decode(&list); err != nil {
+		return err
+	}
+	*l = list
+
+	return nil
+}
+
+// Unmet describes the first requirement of the condition which does not hold
+// for the environment and project directory, or is empty when all hold.
+func (c *Condition) Unmet(env util.Environment, dir string) string {
+	if c == nil {
+		return ""
+	}
+
+	if _, found := util.IndexOfString(c.OS, runtime.GOOS); len(c.OS) > 0 && !found {
+		return fmt.Sprintf("requires os %s", strings.Join(c.OS, " or "))
+	}
+	if c.NativeDocker != nil && *c.NativeDocker != util.SupportsNativeDocker() {
+		if *c.NativeDocker {
+			return "requires native Docker"
+		}
+		return "requires Docker in a virtual machine"
+	}
+	for _, name := range c.Env {
+		if env[name] == "" {
+			return fmt.Sprintf("requires $%s to be set", name)
+		}
+	}
+	for _, file := range c.File {
+		path := file
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Sprintf("requires %s to exist", file)
+		}
+	}
+
+	return ""
+}
@@ -3,57 +3,327 @@ package commands
 import (
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/hashicorp/go-version"
 	"github.com/phase2/rig/util"
 	"github.com/urfave/cli"
-	"gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
 )
 
-// Script is the struct for project-defined command configuration
+// Script is the struct for project-defined command configuration.
+// Version 1.0 configuration uses Alias and Run, which are folded into Aliases
+// and Steps when the configuration is loaded.
 type Script struct {
-	ID          string
+	ID          string `yaml:"-"`
 	Alias       string
+	Aliases     []string
 	Description string
+	Dir         string
+	Service     string
+	Container   string
 	Run         []string
+	Steps       []*Step
+	Args        []*ScriptArg
+	Depends     []string
+	Parallel    bool
+	WaitAll     bool `yaml:"wait_all"`
+	Env         map[string]string
+	EnvFile     []string `yaml:"env_file"`
+	When        *Condition
+	Shell       StringList
+
+	// Position of the script definition, used to report problems.
+	file   string
+	line   int
+	column int
+}
+
+// UnmarshalYAML decodes the script while recording where it was defined.
+func (s *Script) UnmarshalYAML(value *yaml.Node) error {
+	type plain Script
+	if err := value.Decode((*plain)(s)); err != nil {
+		return err
+	}
+	s.line, s.column = value.Line, value.Column
+
+	return nil
+}
+
+// StepCommands lists the command of each script step.
+func (s *Script) StepCommands() []string {
+	commands := make([]string, len(s.Steps))
+	for i, step := range s.Steps {
+		commands[i] = step.Run
+	}
+
+	return commands
+}
+
+// ArgValues resolves the value of every declared argument from those given,
+// falling back to defaults. Required arguments must have a value and values
+// must be one of the choices when these are listed.
+func (s *Script) ArgValues(given map[string]string) (map[string]string, error) {
+	values := map[string]string{}
+	for _, arg := range s.Args {
+		value, ok := given[arg.Name]
+		if !ok || value == "" {
+			value = arg.Default
+		}
+
+		if value == "" && arg.Required {
+			return nil, fmt.Errorf("Project script '%s' requires the --%s argument", s.ID, arg.Name)
+		}
+		if _, found := util.IndexOfString(arg.Choices, value); value != "" && len(arg.Choices) > 0 && !found {
+			return nil, fmt.Errorf("Argument --%s of project script '%s' must be one of: %s", arg.Name, s.ID, strings.Join(arg.Choices, ", "))
+		}
+		values[arg.Name] = value
+	}
+
+	return values, nil
+}
+
+// argPlaceholder matches references to script arguments in steps, such as
+// {{ env }}.
+var argPlaceholder = regexp.MustCompile(`\{\{\s*([A-Za-z][A-Za-z0-9_-]*)\s*\}\}`)
+
+// argName matches the names allowed for script arguments.
+var argName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+
+// RenderStep replaces argument placeholders in a step command with the
+// argument values, written as literals of the shell running the step.
+func RenderStep(command string, values map[string]string, shell *Shell) (string, error) {
+	if shell.Literal == nil {
+		if match := argPlaceholder.FindStringSubmatch(command); match != nil {
+			return "", fmt.Errorf("argument '%s' can not be quoted for the custom shell '%s'", match[1], shell.Name)
+		}
+		return command, nil
+	}
+
+	return renderArgs(command, values, shell.Literal), nil
+}
+
+// RenderCall replaces argument placeholders in the arguments of a step calling
+// another project script, quoted so they are split back into the same values.
+func RenderCall(line string, values map[string]string) string {
+	return renderArgs(line, values, util.QuotePosixShellArg)
+}
+
+// renderArgs replaces argument placeholders with the quoted argument values.
+func renderArgs(command string, values map[string]string, quote func(string) string) string {
+	return argPlaceholder.ReplaceAllStringFunc(command, func(placeholder string) string {
+		return quote(values[argPlaceholder.FindStringSubmatch(placeholder)[1]])
+	})
+}
+
+// scriptReference matches a step calling another project script, written as
+// @id followed by the arguments for that script.
+var scriptReference = regexp.MustCompile(`^@(\S+)\s*(.*)$`)
+
+// ScriptReference determines whether a step command calls another project
+// script, such as `@deploy --env=staging`, returning its id and arguments.
+func ScriptReference(command string) (string, string, bool) {
+	match := scriptReference.FindStringSubmatch(strings.TrimSpace(command))
+	if match == nil {
+		return "", "", false
+	}
+
+	return match[1], match[2], true
+}
+
+// ScriptArg is a named argument of a project script, given as a flag such as
+// --env=staging and referenced in steps as {{ env }}.
+type ScriptArg struct {
+	Name        string
+	Description string
+	Required    bool
+	Default     string
+	Choices     []string
+}
+
+// Step is a single command within a project script.
+type Step struct {
+	Name            string
+	Run             string
+	Timeout         time.Duration
+	Retries         int
+	RetryDelay      time.Duration `yaml:"retry_delay"`
+	ContinueOnError bool          `yaml:"continue_on_error"`
+	When            *Condition
+}
+
+// UnmarshalYAML accepts a step as either a plain command string or a mapping.
+func (s *Step) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		s.Run = value.Value
+		return nil
+	}
+
+	type plain Step
+	return value.Decode((*plain)(s))
 }
 
 // Sync is the struct for sync configuration
 type Sync struct {
+	// Driver names the SyncDriver keeping the volume up to date, by default
+	// bind on Linux and unison elsewhere.
+	Driver string
+	// Path is the directory synced, relative to the project directory, which
+	// is synced as a whole by default.
+	Path   string
 	Volume string
-	Ignore []string
+	Ignore SyncIgnores
+	// IgnoreFrom names pattern files such as .gitignore and .dockerignore,
+	// relative to the synced directory, translated into further ignore rules.
+	IgnoreFrom []string `yaml:"ignore_from"`
+	// Interval is the time between the syncs of the rsync-watch driver, such
+	// as 5s, by default one second.
+	Interval string
+}
+
+// SyncMappings lists the directories synced into volumes.
+type SyncMappings []*Sync
+
+// UnmarshalYAML accepts a single mapping as well as a list of them.
+func (m *SyncMappings) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.MappingNode {
+		sync := &Sync{}
+		if err := value.Decode(sync); err != nil {
+			return err
+		}
+		*m = SyncMappings{sync}
+		return nil
+	}
+
+	var list []*Sync
+	if err := value.Decode(&list); err != nil {
+		return err
+	}
+	*m = list
+
+	return nil
+}
+
+// SyncIgnores is the list of unison ignore rules, such as "Path vendor/".
+type SyncIgnores []string
+
+// unisonIgnoreTypes maps structured ignore keys to unison pattern types.
+var unisonIgnoreTypes = map[string]string{
+	"name":      "Name",
+	"path":      "Path",
+	"regex":     "Regex",
+	"belowpath": "BelowPath",
+}
+
+// UnmarshalYAML accepts ignore rules written in unison syntax (version 1.0)
+// or as single-key mappings such as `path: vendor/` (version 2.0).
+func (i *SyncIgnores) UnmarshalYAML(value *yaml.Node) error {
+	var rules []yaml.Node
+	if err := value.Decode(&rules); err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		if rule.Kind == yaml.MappingNode && len(rule.Content) == 2 {
+			*i = append(*i, fmt.Sprintf("%s %s", unisonIgnoreTypes[rule.Content[0].Value], rule.Content[1].Value))
+		} else {
+			*i = append(*i, rule.Value)
+		}
+	}
+
+	return nil
 }
 
 // ProjectConfig is the struct for the outrigger.yml file
 type ProjectConfig struct {
-	File string
-	Path string
+	File string `yaml:"-"`
+	Path string `yaml:"-"`
+	// Files lists every file the configuration was merged from, from lowest
+	// to highest precedence.
+	Files []string `yaml:"-"`
 
 	Scripts   map[string]*Script
-	Sync      *Sync
+	Sync      SyncMappings
 	Namespace string
 	Version   string
+	Requires  string
 	Bin       string
+	Shell     StringList
+	Env       map[string]string
+	EnvFile   []string `yaml:"env_file"`
+	Hooks     map[string]*Hook
+	// Project is the name the example configuration has long given the
+	// namespace, used when no namespace is set.
+	Project string
+}
+
+// Hook lists the project scripts to run before and after a built-in command.
+type Hook struct {
+	Pre  []string
+	Post []string
 }
 
 // NewProjectConfig creates a new ProjectConfig using configured or default locations
 func NewProjectConfig() *ProjectConfig {
-	readyConfig := &ProjectConfig{}
-	projectConfigFile := os.Getenv("RIG_PROJECT_CONFIG_FILE")
+	config, err := LoadProjectConfig()
+	if err != nil {
+		util.Logger().Error("%s", err)
+	}
+
+	return config
+}
 
-	if projectConfigFile == "" {
-		projectConfigFile, _ = FindProjectConfigFilePath() // nolint: gosec
+// loadedProjectConfig holds the last configuration read by LoadProjectConfig,
+// so the commands and hooks of a run share it rather than each parsing the
+// files again.
+var loadedProjectConfig struct {
+	file   string
+	config *ProjectConfig
+	err    error
+}
+
+// LoadProjectConfig creates a new ProjectConfig using configured or default
+// locations, as NewProjectConfig does. A configuration requiring another
+// version of rig is returned as a RigVersionError along with an empty
+// configuration, so commands can stop rather than run without it. The
+// configuration is read once, later calls for the same file reuse it.
+func LoadProjectConfig() (*ProjectConfig, error) {
+	projectConfigFile, _ := ProjectConfigFilePath() // nolint: gosec
+	if loadedProjectConfig.config != nil && loadedProjectConfig.file == projectConfigFile {
+		return loadedProjectConfig.config, loadedProjectConfig.err
 	}
 
+	readyConfig := &ProjectConfig{}
+	var mismatch error
 	if projectConfigFile != "" {
-		if config, err := NewProjectConfigFromFile(projectConfigFile); err == nil {
+		config, err := NewProjectConfigFromFile(projectConfigFile)
+		if err == nil {
 			readyConfig = config
+		} else if versionErr, ok := err.(*RigVersionError); ok {
+			mismatch = versionErr
+		} else if problems, ok := err.(ConfigErrors); ok {
+			util.Logger().Warning("Ignoring invalid project configuration %s with %d problem(s). Run 'rig project validate' for details.", projectConfigFile, len(problems))
 		}
 	}
+	loadedProjectConfig.file, loadedProjectConfig.config, loadedProjectConfig.err = projectConfigFile, readyConfig, mismatch
 
-	return readyConfig
+	return readyConfig, mismatch
+}
+
+// ProjectConfigFilePath determines the project config file to use, preferring
+// $RIG_PROJECT_CONFIG_FILE over discovery from the current directory.
+func ProjectConfigFilePath() (string, error) {
+	if projectConfigFile := os.Getenv("RIG_PROJECT_CONFIG_FILE"); projectConfigFile != "" {
+		return projectConfigFile, nil
+	}
+
+	return FindProjectConfigFilePath()
 }
 
 // FindProjectConfigFilePath traverses directory structure looking for an outrigger project config file.
@@ -77,35 +347,48 @@ func FindProjectConfigFilePath() (string, error) {
 	return "", errors.New("no outrigger configuration file found")
 }
 
-// NewProjectConfigFromFile creates a new ProjectConfig from the specified file.
-// @todo do not use the logger here, instead return errors.
-// Use of the logger here initializes it in non-verbose mode.
-// nolint: gocyclo
+// NewProjectConfigFromFile creates a new ProjectConfig from the specified file,
+// merged with the files it includes and any local overrides.
+// The result is checked against the schema for its declared version and every
+// problem found is returned as ConfigErrors.
 func NewProjectConfigFromFile(filename string) (*ProjectConfig, error) {
-	logger := util.Logger()
 	filepath, _ := filepath.Abs(filename) // nolint: gosec
 	config := &ProjectConfig{
 		File: filename,
 		Path: filepath,
 	}
 
-	yamlFile, err := ioutil.ReadFile(config.File)
+	document, err := loadProjectConfigDocument(filename)
+	config.Files = document.files
 	if err != nil {
-		logger.Verbose("No project configuration file could be read at: %s", config.File)
+		if _, invalid := err.(ConfigErrors); !invalid {
+			util.Logger().Verbose("No project configuration file could be read at: %s", config.File)
+		}
 		return config, err
 	}
 
-	if err := yaml.Unmarshal(yamlFile, config); err != nil {
-		logger.Channel.Error.Fatalf("Failure parsing YAML config: %v", err)
+	if problems := validateProjectConfigSchema(&schemaValidator{file: filename, sources: document.sources}, document.root); len(problems) > 0 {
+		return config, problems
 	}
 
-	if err := config.ValidateConfigVersion(); err != nil {
-		logger.Channel.Error.Fatalf("Failure in %s: %s", filename, err)
+	if err := document.root.Decode(config); err != nil {
+		return config, ConfigErrors{yamlSyntaxError(filename, err)}
+	}
+
+	if scripts := mappingValue(document.root, "scripts"); scripts != nil {
+		for i := 0; i+1 < len(scripts.Content); i += 2 {
+			if script := config.Scripts[scripts.Content[i].Value]; script != nil {
+				script.file = document.sources[resolveAlias(scripts.Content[i+1])]
+			}
+		}
 	}
 
 	if len(config.Bin) == 0 {
 		config.Bin = "./bin"
 	}
+	if config.Namespace == "" {
+		config.Namespace = config.Project
+	}
 
 	for id, script := range config.Scripts {
 		if script != nil {
@@ -113,21 +396,100 @@ func NewProjectConfigFromFile(filename string) (*ProjectConfig, error) {
 				config.Scripts[id].Description = fmt.Sprintf("Configured operation for '%s'", id)
 			}
 			config.Scripts[id].ID = id
+
+			if script.Alias != "" {
+				script.Aliases = append([]string{script.Alias}, script.Aliases...)
+			}
+			for _, run := range script.Run {
+				script.Steps = append(script.Steps, &Step{Run: run})
+			}
 		}
 	}
 
+	if err := config.CheckRequiredRigVersion(RigVersion); err != nil {
+		return config, err
+	}
+
 	return config, nil
 }
 
-// ValidateConfigVersion ensures our configuration data structure conforms to our ad hoc schema.
-// @TODO do this in a more formal way. See docker/libcompose for an example.
+// ScriptShell resolves the shell running the steps of a script, set by the
+// script or otherwise the project. Without either steps are run by sh, or by
+// cmd for scripts run on a Windows host.
+func (c *ProjectConfig) ScriptShell(script *Script) (*Shell, error) {
+	switch {
+	case len(script.Shell) > 0:
+		return NewShell(script.Shell)
+	case len(c.Shell) > 0:
+		return NewShell(c.Shell)
+	case script.Service != "" || script.Container != "":
+		return shells["sh"], nil
+	}
+
+	return DefaultShell(), nil
+}
+
+// RigVersion is the version of the running rig, set on start up.
+var RigVersion = "master"
+
+// RigVersionError reports that a project configuration requires a version of
+// rig other than the one running.
+type RigVersionError struct {
+	File     string
+	Requires string
+	Running  string
+}
+
+// Error explains how to get a version of rig the project can use.
+func (e *RigVersionError) Error() string {
+	return fmt.Sprintf("Project configuration %s requires rig %s, but this is rig %s. Upgrade with 'brew upgrade rig' or download a release from https://github.com/phase2/rig/releases", e.File, e.Requires, e.Running)
+}
+
+// CheckRequiredRigVersion ensures the running version of rig satisfies the
+// version constraint set by 'requires', such as '>= 2.2, < 3'. Development
+// builds, which have no version, are allowed with a warning.
+func (c *ProjectConfig) CheckRequiredRigVersion(running string) error {
+	if c.Requires == "" {
+		return nil
+	}
+
+	constraint, err := version.NewConstraint(c.Requires)
+	if err != nil {
+		return ConfigErrors{&ConfigError{File: c.File, Message: fmt.Sprintf("requires: '%s' is not a version constraint", c.Requires)}}
+	}
+	current, err := version.NewVersion(running)
+	if err != nil {
+		util.Logger().Warning("Project configuration %s requires rig %s, which can not be checked for this %s build", c.File, c.Requires, running)
+		return nil
+	}
+	if !constraint.Check(current) {
+		return &RigVersionError{c.File, c.Requires, running}
+	}
+
+	return nil
+}
+
+// yamlSyntaxError converts a YAML library error into a ConfigError, extracting
+// the line number from the message when one is available.
+func yamlSyntaxError(filename string, err error) *ConfigError {
+	problem := &ConfigError{File: filename, Message: err.Error()}
+	if match := regexp.MustCompile(`^yaml: line (\d+): (.*)$`).FindStringSubmatch(err.Error()); match != nil {
+		problem.Line, _ = strconv.Atoi(match[1]) // nolint: gosec
+		problem.Message = match[2]
+	}
+
+	return problem
+}
+
+// ValidateConfigVersion ensures our configuration declares a supported version.
+// The full structure is checked by ValidateProjectConfigSchema when loading.
 func (c *ProjectConfig) ValidateConfigVersion() error {
 	if len(c.Version) == 0 {
 		return fmt.Errorf("no 'version' property detected")
 	}
 
-	if c.Version != "1.0" {
-		return fmt.Errorf("version '1.0' is the only supported value, found '%s'", c.Version)
+	if _, ok := projectConfigSchemas[c.Version]; !ok {
+		return fmt.Errorf("version '%s' is not supported, expected one of: %s", c.Version, strings.Join(SupportedConfigVersions(), ", "))
 	}
 
 	return nil
@@ -143,43 +505,297 @@ func (c *ProjectConfig) NotEmpty() bool {
 }
 
 // ValidateProjectScripts will validate the config scripts against a set of rules/norms
-// nolint: gocyclo
+// and halt with every problem found.
 func (c *ProjectConfig) ValidateProjectScripts(subcommands []cli.Command) {
 	logger := util.Logger()
 
-	if c.Scripts != nil {
-		for id, script := range c.Scripts {
-
-			// Check for an empty script
-			if script == nil {
-				logger.Channel.Error.Fatalf("Project script '%s' has no configuration", id)
-			}
-
-			// Check for scripts with conflicting aliases with existing subcommands or subcommand aliases
-			for _, subcommand := range subcommands {
-				if id == subcommand.Name {
-					logger.Channel.Error.Fatalf("Project script name '%s' conflicts with command name '%s'. Please choose a different script name", id, subcommand.Name)
-				} else if script.Alias == subcommand.Name {
-					logger.Channel.Error.Fatalf("Project script alias '%s' on script '%s' conflicts with command name '%s'. Please choose a different script alias", script.Alias, id, subcommand.Name)
-				} else if subcommand.Aliases != nil {
-					for _, alias := range subcommand.Aliases {
-						if id == alias {
-							logger.Channel.Error.Fatalf("Project script name '%s' conflicts with command alias '%s' on command '%s'. Please choose a different script name", id, alias, subcommand.Name)
-						} else if script.Alias == alias {
-							logger.Channel.Error.Fatalf("Project script alias '%s' on script '%s' conflicts with command alias '%s' on command '%s'. Please choose a different script alias", script.Alias, id, alias, subcommand.Name)
-						}
+	if problems := c.CheckProjectScripts(subcommands); len(problems) > 0 {
+		for _, problem := range problems {
+			logger.Channel.Error.Println(problem)
+		}
+		os.Exit(1)
+	}
+
+	for id, script := range c.Scripts {
+		// Check for scripts with more than 10 run commands
+		if len(script.Steps) > 10 {
+			logger.Warning("Project script '%s' has more than 10 steps (%d). You should create a shell script to contain those.", id, len(script.Steps))
+		}
+	}
+}
+
+// CheckProjectScripts checks the config scripts against a set of rules/norms,
+// returning every problem found.
+// nolint: gocyclo
+func (c *ProjectConfig) CheckProjectScripts(subcommands []cli.Command) ConfigErrors {
+	problems := ConfigErrors{}
+	if c.Scripts == nil {
+		return problems
+	}
+
+	ids := []string{}
+	for id := range c.Scripts {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		script := c.Scripts[id]
+
+		// Check for an empty script
+		if script == nil {
+			problems = append(problems, c.scriptError(&Script{}, "Project script '%s' has no configuration", id))
+			continue
+		}
+
+		// Check for scripts with conflicting aliases with existing subcommands or subcommand aliases
+		for _, subcommand := range subcommands {
+			if id == subcommand.Name {
+				problems = append(problems, c.scriptError(script, "Project script name '%s' conflicts with command name '%s'. Please choose a different script name", id, subcommand.Name))
+			}
+			for _, scriptAlias := range script.Aliases {
+				if scriptAlias == subcommand.Name {
+					problems = append(problems, c.scriptError(script, "Project script alias '%s' on script '%s' conflicts with command name '%s'. Please choose a different script alias", scriptAlias, id, subcommand.Name))
+				}
+			}
+			for _, alias := range subcommand.Aliases {
+				if id == alias {
+					problems = append(problems, c.scriptError(script, "Project script name '%s' conflicts with command alias '%s' on command '%s'. Please choose a different script name", id, alias, subcommand.Name))
+				}
+				for _, scriptAlias := range script.Aliases {
+					if scriptAlias == alias {
+						problems = append(problems, c.scriptError(script, "Project script alias '%s' on script '%s' conflicts with command alias '%s' on command '%s'. Please choose a different script alias", scriptAlias, id, alias, subcommand.Name))
 					}
 				}
 			}
+		}
+
+		// Check for scripts with no run commands
+		if len(script.Steps) == 0 {
+			problems = append(problems, c.scriptError(script, "Project script '%s' does not have any run commands.", id))
+		}
+
+		problems = append(problems, c.checkScriptArgs(script)...)
+
+		// Check for scripts set to run in both a service and a container
+		if script.Service != "" && script.Container != "" {
+			problems = append(problems, c.scriptError(script, "Project script '%s' may set either 'service' or 'container', not both", id))
+		}
+
+		problems = append(problems, c.checkScriptCalls(script)...)
+
+		// Check for custom shells without a place for the step
+		if len(script.Shell) > 0 {
+			if _, err := NewShell(script.Shell); err != nil {
+				problems = append(problems, c.scriptError(script, "Project script '%s' has an invalid shell: %s", id, err))
+			}
+		}
+
+		// Check for dependencies on scripts that do not exist
+		for _, dependency := range script.Depends {
+			if c.Scripts[dependency] == nil {
+				problems = append(problems, c.scriptError(script, "Project script '%s' depends on unknown script '%s'", id, dependency))
+			}
+		}
+	}
+
+	// Check for a project shell without a place for the step
+	if len(c.Shell) > 0 {
+		if _, err := NewShell(c.Shell); err != nil {
+			problems = append(problems, &ConfigError{File: c.File, Message: fmt.Sprintf("The project has an invalid shell: %s", err)})
+		}
+	}
+
+	// Check for hooks running scripts that do not exist
+	for _, event := range HookEvents {
+		if hook := c.Hooks[event]; hook != nil {
+			for _, id := range append(append([]string{}, hook.Pre...), hook.Post...) {
+				if c.Scripts[id] == nil {
+					problems = append(problems, &ConfigError{File: c.File, Message: fmt.Sprintf("Hook for '%s' runs unknown script '%s'", event, id)})
+				}
+			}
+		}
+	}
+
+	return append(problems, c.checkDependencyCycles(ids)...)
+}
+
+// checkDependencyCycles reports each cycle formed by the dependencies of the
+// scripts once. Unknown dependencies are reported on their own, so they are
+// left out rather than stopping the search for cycles.
+func (c *ProjectConfig) checkDependencyCycles(ids []string) ConfigErrors {
+	known := &ProjectConfig{Scripts: map[string]*Script{}}
+	for _, id := range ids {
+		if script := c.Scripts[id]; script != nil {
+			copied := *script
+			copied.Depends = nil
+			for _, dependency := range script.Depends {
+				if c.Scripts[dependency] != nil {
+					copied.Depends = append(copied.Depends, dependency)
+				}
+			}
+			known.Scripts[id] = &copied
+		}
+	}
 
-			// Check for scripts with no run commands
-			if script.Run == nil || len(script.Run) == 0 {
-				logger.Channel.Error.Fatalf("Project script '%s' does not have any run commands.", id)
-			} else if len(script.Run) > 10 {
-				// Check for scripts with more than 10 run commands
-				logger.Warning("Project script '%s' has more than 10 run items (%d). You should create a shell script to contain those.", id, len(script.Run))
+	problems := ConfigErrors{}
+	reported := map[string]bool{}
+	for _, id := range ids {
+		if script := known.Scripts[id]; script != nil {
+			_, err := known.ScriptExecutionOrder(script)
+			if cycle, ok := err.(*DependencyCycleError); ok && !reported[strings.Join(cycle.Cycle(), " ")] {
+				reported[strings.Join(cycle.Cycle(), " ")] = true
+				problems = append(problems, c.scriptError(c.Scripts[id], "%s", err))
 			}
 		}
 	}
 
+	return problems
+}
+
+// checkScriptCalls checks the steps of a script which call other scripts.
+// Calls run in the rig process, so they cannot be stopped by a timeout or
+// run alongside other steps.
+func (c *ProjectConfig) checkScriptCalls(script *Script) ConfigErrors {
+	problems := ConfigErrors{}
+	for _, step := range script.Steps {
+		id, args, called := ScriptReference(step.Run)
+		if !called {
+			continue
+		}
+
+		if c.Scripts[id] == nil {
+			problems = append(problems, c.scriptError(script, "Project script '%s' calls unknown script '%s'", script.ID, id))
+		}
+		if _, err := util.SplitShellArgs(args); err != nil {
+			problems = append(problems, c.scriptError(script, "Project script '%s' calls '%s' with invalid arguments: %s", script.ID, id, err))
+		}
+		if script.Parallel {
+			problems = append(problems, c.scriptError(script, "Project script '%s' may not call '%s' from a parallel step", script.ID, id))
+		}
+		if step.Timeout > 0 {
+			problems = append(problems, c.scriptError(script, "Project script '%s' may not set a timeout on the step calling '%s'", script.ID, id))
+		}
+	}
+
+	return problems
+}
+
+// checkScriptArgs checks the declared arguments of a script and the
+// placeholders used in its steps.
+func (c *ProjectConfig) checkScriptArgs(script *Script) ConfigErrors {
+	problems := ConfigErrors{}
+	declared := map[string]bool{}
+	for _, arg := range script.Args {
+		if !argName.MatchString(arg.Name) {
+			problems = append(problems, c.scriptError(script, "Project script '%s' has an invalid argument name '%s'", script.ID, arg.Name))
+		} else if arg.Name == "help" || arg.Name == "h" {
+			problems = append(problems, c.scriptError(script, "Project script '%s' argument '%s' conflicts with the help flag", script.ID, arg.Name))
+		} else if declared[arg.Name] {
+			problems = append(problems, c.scriptError(script, "Project script '%s' declares argument '%s' more than once", script.ID, arg.Name))
+		}
+		declared[arg.Name] = true
+
+		if _, found := util.IndexOfString(arg.Choices, arg.Default); arg.Default != "" && len(arg.Choices) > 0 && !found {
+			problems = append(problems, c.scriptError(script, "Default '%s' of argument '%s' on script '%s' is not one of its choices", arg.Default, arg.Name, script.ID))
+		}
+	}
+
+	shell, err := c.ScriptShell(script)
+	for _, step := range script.Steps {
+		for _, match := range argPlaceholder.FindAllStringSubmatch(step.Run, -1) {
+			if !declared[match[1]] {
+				problems = append(problems, c.scriptError(script, "Project script '%s' uses undeclared argument '%s' in step: %s", script.ID, match[1], step.Run))
+			} else if _, _, called := ScriptReference(step.Run); !called && err == nil && shell.Literal == nil {
+				problems = append(problems, c.scriptError(script, "Project script '%s' uses argument '%s', which can not be quoted for the custom shell '%s', in step: %s", script.ID, match[1], shell.Name, step.Run))
+			}
+		}
+	}
+
+	return problems
+}
+
+// ScriptExecutionOrder resolves the dependencies of a script into the order in
+// which they must run, ending with the script itself. Each script appears once
+// no matter how many scripts depend on it.
+func (c *ProjectConfig) ScriptExecutionOrder(script *Script) ([]*Script, error) {
+	const (
+		visiting = iota + 1
+		visited
+	)
+	state := map[string]int{}
+	order := []*Script{}
+
+	var visit func(script *Script, path []string) error
+	visit = func(script *Script, path []string) error {
+		path = append(path[:len(path):len(path)], script.ID)
+		switch state[script.ID] {
+		case visiting:
+			return &DependencyCycleError{path}
+		case visited:
+			return nil
+		}
+
+		state[script.ID] = visiting
+		for _, id := range script.Depends {
+			dependency := c.Scripts[id]
+			if dependency == nil {
+				return fmt.Errorf("Project script '%s' depends on unknown script '%s'", script.ID, id)
+			}
+			if err := visit(dependency, path); err != nil {
+				return err
+			}
+		}
+		state[script.ID] = visited
+		order = append(order, script)
+
+		return nil
+	}
+
+	if err := visit(script, []string{}); err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// DependencyCycleError reports project scripts whose dependencies lead back to
+// themselves, along the path of dependencies followed to find the cycle.
+type DependencyCycleError struct {
+	Path []string
+}
+
+// Error describes the path of dependencies ending in the cycle.
+func (e *DependencyCycleError) Error() string {
+	return fmt.Sprintf("Project script dependencies form a cycle: %s", strings.Join(e.Path, " -> "))
+}
+
+// Cycle lists the scripts in the cycle, sorted so a cycle is named the same
+// whichever script the path started from.
+func (e *DependencyCycleError) Cycle() []string {
+	last := e.Path[len(e.Path)-1]
+	for i, id := range e.Path {
+		if id == last {
+			cycle := append([]string{}, e.Path[i:len(e.Path)-1]...)
+			sort.Strings(cycle)
+			return cycle
+		}
+	}
+
+	return e.Path
+}
+
+// scriptError creates a ConfigError located at the definition of the script.
+func (c *ProjectConfig) scriptError(script *Script, format string, a ...interface{}) *ConfigError {
+	file := script.file
+	if file == "" {
+		file = c.File
+	}
+
+	return &ConfigError{
+		File:    file,
+		Line:    script.line,
+		Column:  script.column,
+		Message: fmt.Sprintf(format, a...),
+	}
 }
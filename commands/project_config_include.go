@@ -0,0 +1,277 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/phase2/rig/util"
+	"gopkg.in/yaml.v3"
+)
+
+// projectConfigDocument is a project configuration merged from its file, the
+// files it includes and local overrides. It records which file every node
+// came from so problems and values can be traced back to their source.
+type projectConfigDocument struct {
+	root    *yaml.Node
+	sources map[*yaml.Node]string
+	// files lists every loaded file, from lowest to highest precedence.
+	files []string
+	// loading holds the chain of files being included, to detect cycles.
+	loading []string
+	// includes holds the include keys read, which version 1.0 does not allow.
+	includes []*yaml.Node
+}
+
+// LocalProjectConfigFilePath names the file of personal overrides for a
+// project configuration file, such as outrigger.local.yml for outrigger.yml.
+func LocalProjectConfigFilePath(filename string) string {
+	ext := filepath.Ext(filename)
+	return strings.TrimSuffix(filename, ext) + ".local" + ext
+}
+
+// IgnoreLocalProjectConfig adds the local overrides file of a project
+// configuration, such as outrigger.local.yml, to the .gitignore file of a git
+// repository in the same directory. The pattern added is returned, or nothing
+// when the directory is not a repository or the file is ignored already.
+func IgnoreLocalProjectConfig(file string) (string, error) {
+	dir := filepath.Dir(file)
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		return "", nil
+	}
+
+	pattern := "/" + filepath.Base(LocalProjectConfigFilePath(file))
+	gitignore := filepath.Join(dir, ".gitignore")
+	content, err := ioutil.ReadFile(gitignore) // nolint: gosec
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		if line = strings.TrimSpace(line); line == pattern || line == pattern[1:] {
+			return "", nil
+		}
+	}
+
+	if len(content) > 0 && !bytes.HasSuffix(content, []byte("\n")) {
+		content = append(content, '\n')
+	}
+	content = append(content, pattern+"\n"...)
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(gitignore); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	return pattern, ioutil.WriteFile(gitignore, content, mode)
+}
+
+// LocalProjectConfigTracked determines whether git tracks the local overrides
+// file of a project configuration, which is meant to stay personal.
+func LocalProjectConfigTracked(file string) bool {
+	local := LocalProjectConfigFilePath(file)
+	if _, err := os.Stat(local); err != nil {
+		return false
+	}
+
+	/* #nosec */
+	tracked := exec.Command("git", "ls-files", "--error-unmatch", filepath.Base(local))
+	tracked.Dir = filepath.Dir(local)
+	return tracked.Run() == nil
+}
+
+// loadProjectConfigDocument reads a project configuration file along with its
+// includes, then merges the local override file on top when one exists,
+// making sure git ignores it.
+// Included files are merged in order beneath the file including them. In
+// each merge mappings are combined key by key and other values, including
+// lists, are replaced. Includes are only allowed from version 2.0.
+func loadProjectConfigDocument(filename string) (*projectConfigDocument, error) {
+	d := &projectConfigDocument{sources: map[*yaml.Node]string{}}
+
+	root, err := d.load(filename)
+	if err != nil {
+		return d, err
+	}
+
+	local := LocalProjectConfigFilePath(filename)
+	if _, err := os.Stat(local); err == nil {
+		if added, err := IgnoreLocalProjectConfig(filename); err != nil {
+			util.Logger().Verbose("Could not add %s to .gitignore: %s", local, err)
+		} else if added != "" {
+			util.Logger().Info("Added %s to .gitignore, it holds personal overrides", added)
+		}
+		overrides, err := d.load(local)
+		if err != nil {
+			return d, err
+		}
+		if err := d.merge(root, overrides); err != nil {
+			return d, err
+		}
+	}
+	d.root = root
+
+	if version := mappingValue(root, "version"); version != nil && version.Value == "1.0" && len(d.includes) > 0 {
+		include := d.includes[0]
+		return d, ConfigErrors{{File: d.sources[include], Line: include.Line, Column: include.Column, Message: "include: not supported in version 1.0, use version 2.0 to include files"}}
+	}
+
+	return d, nil
+}
+
+// load reads a single file and merges its includes beneath it.
+func (d *projectConfigDocument) load(filename string) (*yaml.Node, error) {
+	for _, loading := range d.loading {
+		if loading == filename {
+			return nil, ConfigErrors{{File: filename, Message: fmt.Sprintf("include cycle: %s -> %s", strings.Join(d.loading, " -> "), filename)}}
+		}
+	}
+	d.loading = append(d.loading, filename)
+	defer func() { d.loading = d.loading[:len(d.loading)-1] }()
+
+	content, err := ioutil.ReadFile(filename) // nolint: gosec
+	if err != nil {
+		if len(d.loading) > 1 {
+			return nil, ConfigErrors{{File: d.loading[len(d.loading)-2], Message: fmt.Sprintf("could not include %s: %s", filename, err)}}
+		}
+		return nil, err
+	}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, ConfigErrors{yamlSyntaxError(filename, err)}
+	}
+	if len(document.Content) == 0 {
+		return nil, ConfigErrors{{File: filename, Message: "configuration file is empty"}}
+	}
+	root := document.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, ConfigErrors{{File: filename, Line: root.Line, Column: root.Column, Message: fmt.Sprintf("expected a mapping at the top level, found %s", describeNode(root))}}
+	}
+	d.record(root, filename)
+
+	includes, err := d.takeIncludes(root, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: root.Line, Column: root.Column}
+	d.sources[merged] = filename
+	for _, include := range includes {
+		included, err := d.load(include)
+		if err != nil {
+			return nil, err
+		}
+		if err := d.merge(merged, included); err != nil {
+			return nil, err
+		}
+	}
+	if err := d.merge(merged, root); err != nil {
+		return nil, err
+	}
+	d.files = append(d.files, filename)
+
+	return merged, nil
+}
+
+// takeIncludes removes the include list from a top-level mapping, returning
+// the paths it lists relative to the including file.
+func (d *projectConfigDocument) takeIncludes(root *yaml.Node, filename string) ([]string, error) {
+	includes := []string{}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != "include" {
+			continue
+		}
+		d.includes = append(d.includes, root.Content[i])
+
+		list := resolveAlias(root.Content[i+1])
+		if list.Kind != yaml.SequenceNode {
+			return nil, ConfigErrors{{File: filename, Line: list.Line, Column: list.Column, Message: fmt.Sprintf("include: expected a list, found %s", describeNode(list))}}
+		}
+		for _, item := range list.Content {
+			item = resolveAlias(item)
+			if item.Kind != yaml.ScalarNode || isNull(item) {
+				return nil, ConfigErrors{{File: filename, Line: item.Line, Column: item.Column, Message: fmt.Sprintf("include: expected a file path, found %s", describeNode(item))}}
+			}
+			path := item.Value
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(filepath.Dir(filename), path)
+			}
+			includes = append(includes, path)
+		}
+		root.Content = append(root.Content[:i], root.Content[i+2:]...)
+		break
+	}
+
+	return includes, nil
+}
+
+// merge combines the overlay mapping into the base mapping. Files merged at
+// the top level must agree on the version they declare.
+func (d *projectConfigDocument) merge(base, overlay *yaml.Node) error {
+	return d.mergeAt(base, overlay, true)
+}
+
+// mergeAt combines mappings, knowing whether they are at the top level.
+func (d *projectConfigDocument) mergeAt(base, overlay *yaml.Node, topLevel bool) error {
+	for i := 0; i+1 < len(overlay.Content); i += 2 {
+		key, value := overlay.Content[i], resolveAlias(overlay.Content[i+1])
+		if key.Tag == "!!merge" {
+			if err := d.mergeAt(base, value, topLevel); err != nil {
+				return err
+			}
+			continue
+		}
+
+		found := false
+		for j := 0; j+1 < len(base.Content); j += 2 {
+			if base.Content[j].Value != key.Value {
+				continue
+			}
+			found = true
+
+			current := resolveAlias(base.Content[j+1])
+			switch {
+			case topLevel && key.Value == "version" && current.Value != value.Value:
+				return ConfigErrors{{File: d.sources[value], Line: value.Line, Column: value.Column, Message: fmt.Sprintf("version '%s' does not match version '%s' of %s", value.Value, current.Value, d.sources[current])}}
+			case current.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode:
+				if err := d.mergeAt(current, value, false); err != nil {
+					return err
+				}
+			default:
+				base.Content[j+1] = value
+			}
+			break
+		}
+
+		if !found {
+			base.Content = append(base.Content, key, value)
+		}
+	}
+
+	return nil
+}
+
+// record notes the file every node of a tree came from.
+func (d *projectConfigDocument) record(node *yaml.Node, filename string) {
+	if _, ok := d.sources[node]; ok {
+		return
+	}
+	d.sources[node] = filename
+	for _, child := range node.Content {
+		d.record(child, filename)
+	}
+}
+
+// source describes where a node was defined as file:line, with the file
+// relative to the project directory when possible.
+func (d *projectConfigDocument) source(node *yaml.Node, dir string) string {
+	file := d.sources[node]
+	if relative, err := filepath.Rel(dir, file); err == nil && !strings.HasPrefix(relative, "..") {
+		file = relative
+	}
+
+	return fmt.Sprintf("%s:%d", file, node.Line)
+}
@@ -0,0 +1,104 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnoreLocalProjectConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rig-project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "outrigger.yml")
+
+	if added, err := IgnoreLocalProjectConfig(file); err != nil || added != "" {
+		t.Errorf("expected nothing to be ignored outside a repository, found %s (%v)", added, err)
+	}
+
+	if err = os.Mkdir(filepath.Join(dir, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	gitignore := filepath.Join(dir, ".gitignore")
+	if err = ioutil.WriteFile(gitignore, []byte("/vendor"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if added, err := IgnoreLocalProjectConfig(file); err != nil || added != "/outrigger.local.yml" {
+		t.Errorf("expected the local overrides to be ignored, found %s (%v)", added, err)
+	}
+	if added, err := IgnoreLocalProjectConfig(file); err != nil || added != "" {
+		t.Errorf("expected the local overrides to be ignored once, found %s (%v)", added, err)
+	}
+	content, err := ioutil.ReadFile(gitignore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "/vendor\n/outrigger.local.yml\n" {
+		t.Errorf("unexpected .gitignore: %q", content)
+	}
+	if info, err := os.Stat(gitignore); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected .gitignore to keep its permissions, found %v (%v)", info.Mode(), err)
+	}
+}
+
+func TestLocalProjectConfigTracked(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir, err := ioutil.TempDir("", "rig-project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "outrigger.yml")
+	if err = ioutil.WriteFile(filepath.Join(dir, "outrigger.local.yml"), []byte("scripts: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	git := func(args ...string) {
+		command := exec.Command("git", args...)
+		command.Dir = dir
+		if output, err := command.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %s", args, output)
+		}
+	}
+	git("init", "-q")
+	if LocalProjectConfigTracked(file) {
+		t.Error("expected an untracked local overrides file")
+	}
+	git("add", "outrigger.local.yml")
+	if !LocalProjectConfigTracked(file) {
+		t.Error("expected the local overrides file to be tracked")
+	}
+}
+
+func TestLoadingLocalProjectConfigIgnoresIt(t *testing.T) {
+	dir, cleanup := newTestProject(t, "version: 2.0\nscripts: {}\n")
+	defer cleanup()
+	if err := os.Mkdir(filepath.Join(dir, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "outrigger.yml")
+
+	gitignore := filepath.Join(dir, ".gitignore")
+	if _, err := NewProjectConfigFromFile(file); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(gitignore); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be ignored without local overrides, found %v", err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "outrigger.local.yml"), []byte("scripts: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewProjectConfigFromFile(file); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := ioutil.ReadFile(gitignore); err != nil || string(content) != "/outrigger.local.yml\n" {
+		t.Errorf("expected loading the local overrides to ignore them, found %q (%v)", content, err)
+	}
+}
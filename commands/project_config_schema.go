@@ -0,0 +1,576 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-version"
+	"github.com/phase2/rig/util"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigError describes a single problem found in a project configuration file.
+type ConfigError struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+// Error formats the problem in the conventional file:line:column form so it
+// can be consumed by editors and pre-commit tooling.
+func (e *ConfigError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.File, e.Message)
+	} else if e.Column == 0 {
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Message)
+	}
+
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Message)
+}
+
+// ConfigErrors is the collection of every problem found in a project configuration file.
+type ConfigErrors []*ConfigError
+
+// Error joins all problems, one per line.
+func (e ConfigErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+
+	return strings.Join(messages, "\n")
+}
+
+// schema describes the expected shape of a node in the project configuration.
+// Mappings either declare a fixed set of properties or, like scripts keyed by
+// id, a single schema shared by all of their values.
+type schema struct {
+	kind       yaml.Kind
+	tag        string
+	enum       []string
+	properties map[string]*schema
+	required   []string
+	values     *schema
+	items      *schema
+	// exclusive mappings must set exactly one of their properties.
+	exclusive bool
+	// alternatives accept a node matching any of the listed schemas, chosen by
+	// node kind, such as a step given as a command string or a mapping.
+	alternatives []*schema
+	// check validates the value of a scalar beyond its type.
+	check func(value string) error
+}
+
+// stringSchema accepts any scalar, including an empty one. YAML will happily
+// type values such as `true` or `1.0`, but they are all read as strings by rig.
+var stringSchema = &schema{kind: yaml.ScalarNode}
+
+// stringListSchema accepts a list of scalars.
+var stringListSchema = &schema{kind: yaml.SequenceNode, items: stringSchema}
+
+// envSchema accepts a mapping of environment variable names to values.
+var envSchema = &schema{kind: yaml.MappingNode, values: stringSchema}
+
+// boolSchema accepts true or false.
+var boolSchema = &schema{kind: yaml.ScalarNode, tag: "!!bool"}
+
+// durationSchema accepts a duration such as 90s or 10m.
+var durationSchema = &schema{
+	kind: yaml.ScalarNode,
+	check: func(value string) error {
+		if duration, err := time.ParseDuration(value); err != nil || duration <= 0 {
+			return fmt.Errorf("expected a duration such as 90s or 10m, found '%s'", value)
+		}
+		return nil
+	},
+}
+
+// countSchema accepts a whole number of zero or more.
+var countSchema = &schema{
+	kind: yaml.ScalarNode,
+	tag:  "!!int",
+	check: func(value string) error {
+		if count, err := strconv.Atoi(value); err != nil || count < 0 {
+			return fmt.Errorf("expected zero or more, found '%s'", value)
+		}
+		return nil
+	},
+}
+
+// constraintSchema accepts a version constraint such as '>= 2.2, < 3'.
+var constraintSchema = &schema{
+	kind: yaml.ScalarNode,
+	check: func(value string) error {
+		if _, err := version.NewConstraint(value); err != nil {
+			return fmt.Errorf("expected a version constraint such as '>= 2.2', found '%s'", value)
+		}
+		return nil
+	},
+}
+
+// scalarTagNames describes the scalar types enforced by the schema.
+var scalarTagNames = map[string]string{
+	"!!bool": "true or false",
+	"!!int":  "a whole number",
+}
+
+// stringOrListSchema accepts a single string or a list of them.
+var stringOrListSchema = &schema{alternatives: []*schema{stringSchema, stringListSchema}}
+
+// osSchema accepts one or more operating systems as named by Go.
+var osSchema = func() *schema {
+	name := &schema{kind: yaml.ScalarNode, enum: []string{"linux", "darwin", "windows"}}
+	return &schema{alternatives: []*schema{name, {kind: yaml.SequenceNode, items: name}}}
+}()
+
+// conditionSchema accepts the when conditions of a script or step.
+var conditionSchema = &schema{
+	kind: yaml.MappingNode,
+	properties: map[string]*schema{
+		"os":            osSchema,
+		"native_docker": boolSchema,
+		"env":           stringOrListSchema,
+		"file":          stringOrListSchema,
+	},
+}
+
+// shellSchema accepts the name of a shell or a custom command line.
+var shellSchema = &schema{
+	alternatives: []*schema{
+		{kind: yaml.ScalarNode, enum: ShellNames()},
+		stringListSchema,
+	},
+}
+
+// stepSchema accepts a script step as a command string or a named mapping.
+var stepSchema = &schema{
+	alternatives: []*schema{
+		stringSchema,
+		{
+			kind:     yaml.MappingNode,
+			required: []string{"run"},
+			properties: map[string]*schema{
+				"name":              stringSchema,
+				"run":               stringSchema,
+				"timeout":           durationSchema,
+				"retries":           countSchema,
+				"retry_delay":       durationSchema,
+				"continue_on_error": boolSchema,
+				"when":              conditionSchema,
+			},
+		},
+	},
+}
+
+// argsSchema accepts the list of named arguments of a script.
+var argsSchema = &schema{
+	kind: yaml.SequenceNode,
+	items: &schema{
+		kind:     yaml.MappingNode,
+		required: []string{"name"},
+		properties: map[string]*schema{
+			"name":        stringSchema,
+			"description": stringSchema,
+			"required":    boolSchema,
+			"default":     stringSchema,
+			"choices":     stringListSchema,
+		},
+	},
+}
+
+// hooksSchema accepts the pre and post hook scripts of each built-in command.
+var hooksSchema = func() *schema {
+	hooks := &schema{kind: yaml.MappingNode, properties: map[string]*schema{}}
+	for _, event := range HookEvents {
+		hooks.properties[event] = &schema{
+			kind: yaml.MappingNode,
+			properties: map[string]*schema{
+				"pre":  stringListSchema,
+				"post": stringListSchema,
+			},
+		}
+	}
+	return hooks
+}()
+
+// ignoreSchema accepts a single unison ignore rule keyed by its pattern type.
+var ignoreSchema = &schema{
+	kind:      yaml.MappingNode,
+	exclusive: true,
+	properties: map[string]*schema{
+		"name":      stringSchema,
+		"path":      stringSchema,
+		"regex":     stringSchema,
+		"belowpath": stringSchema,
+	},
+}
+
+// syncSchema accepts the sync settings as a single mapping, or a list of
+// mappings each naming its volume.
+var syncSchema = func() *schema {
+	properties := map[string]*schema{
+		"driver":      {kind: yaml.ScalarNode, enum: SyncDriverNames()},
+		"path":        stringSchema,
+		"volume":      stringSchema,
+		"ignore":      {kind: yaml.SequenceNode, items: ignoreSchema},
+		"ignore_from": stringListSchema,
+		"interval":    durationSchema,
+	}
+
+	return &schema{
+		alternatives: []*schema{
+			{kind: yaml.MappingNode, properties: properties},
+			{kind: yaml.SequenceNode, items: &schema{kind: yaml.MappingNode, required: []string{"volume"}, properties: properties}},
+		},
+	}
+}()
+
+// projectConfigSchemas holds the schema for every supported config version.
+var projectConfigSchemas = map[string]*schema{
+	// Version 1.0 is frozen at the keys rig has always accepted. Features
+	// added since are only available in version 2.0.
+	"1.0": {
+		kind:     yaml.MappingNode,
+		required: []string{"version"},
+		properties: map[string]*schema{
+			"version": {kind: yaml.ScalarNode, enum: []string{"1.0"}},
+			"bin":     stringSchema,
+			// The example configuration has long documented 'project' for
+			// the namespace, so both are accepted.
+			"namespace": stringSchema,
+			"project":   stringSchema,
+			"scripts": {
+				kind: yaml.MappingNode,
+				values: &schema{
+					kind:     yaml.MappingNode,
+					required: []string{"run"},
+					properties: map[string]*schema{
+						"alias":       stringSchema,
+						"description": stringSchema,
+						"run":         stringListSchema,
+					},
+				},
+			},
+			"sync": {
+				kind: yaml.MappingNode,
+				properties: map[string]*schema{
+					"volume": stringSchema,
+					"ignore": stringListSchema,
+				},
+			},
+		},
+	},
+	// Version 2.0 allows multiple aliases, named steps and structured ignores,
+	// along with every setting added since.
+	"2.0": {
+		kind:     yaml.MappingNode,
+		required: []string{"version"},
+		properties: map[string]*schema{
+			"version":   {kind: yaml.ScalarNode, enum: []string{"2.0"}},
+			"bin":       stringSchema,
+			"env":       envSchema,
+			"env_file":  stringListSchema,
+			"hooks":     hooksSchema,
+			"requires":  constraintSchema,
+			"shell":     shellSchema,
+			"namespace": stringSchema,
+			"project":   stringSchema,
+			"scripts": {
+				kind: yaml.MappingNode,
+				values: &schema{
+					kind:     yaml.MappingNode,
+					required: []string{"steps"},
+					properties: map[string]*schema{
+						"aliases":     stringListSchema,
+						"description": stringSchema,
+						"dir":         stringSchema,
+						"service":     stringSchema,
+						"container":   stringSchema,
+						"steps":       {kind: yaml.SequenceNode, items: stepSchema},
+						"args":        argsSchema,
+						"depends":     stringListSchema,
+						"parallel":    boolSchema,
+						"wait_all":    boolSchema,
+						"env":         envSchema,
+						"env_file":    stringListSchema,
+						"when":        conditionSchema,
+						"shell":       shellSchema,
+					},
+				},
+			},
+			"sync": syncSchema,
+		},
+	},
+}
+
+// SupportedConfigVersions lists the project config versions rig can load.
+func SupportedConfigVersions() []string {
+	versions := []string{}
+	for version := range projectConfigSchemas {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+// schemaValidator walks a YAML document collecting every schema violation.
+type schemaValidator struct {
+	file string
+	// sources maps nodes merged from other files to the file they came from.
+	sources map[*yaml.Node]string
+	errors  ConfigErrors
+}
+
+// ValidateProjectConfigSchema checks a parsed project config document against
+// the schema for its declared version and returns every problem found.
+func ValidateProjectConfigSchema(file string, document *yaml.Node) ConfigErrors {
+	return validateProjectConfigSchema(&schemaValidator{file: file}, document)
+}
+
+// validateProjectConfigSchema runs a validator over a document.
+func validateProjectConfigSchema(v *schemaValidator, document *yaml.Node) ConfigErrors {
+	root := document
+	if root.Kind == yaml.DocumentNode {
+		if len(root.Content) == 0 {
+			v.add(root, "configuration file is empty")
+			return v.errors
+		}
+		root = root.Content[0]
+	}
+
+	if root.Kind != yaml.MappingNode {
+		v.add(root, "expected a mapping at the top level, found %s", describeNode(root))
+		return v.errors
+	}
+
+	versionNode := mappingValue(root, "version")
+	if versionNode == nil {
+		v.add(root, "no 'version' property detected")
+		return v.errors
+	}
+
+	s, ok := projectConfigSchemas[versionNode.Value]
+	if !ok {
+		v.add(versionNode, "unsupported version '%s', expected one of: %s", versionNode.Value, strings.Join(SupportedConfigVersions(), ", "))
+		return v.errors
+	}
+
+	v.validate(root, s, "")
+	return v.errors
+}
+
+// validate checks a node and its children against the schema.
+// nolint: gocyclo
+func (v *schemaValidator) validate(node *yaml.Node, s *schema, path string) {
+	node = resolveAlias(node)
+
+	if len(s.alternatives) > 0 {
+		expected := []string{}
+		for _, alternative := range s.alternatives {
+			if node.Kind == alternative.kind && !isNull(node) {
+				v.validate(node, alternative, path)
+				return
+			}
+			expected = append(expected, describeKind(alternative.kind))
+		}
+		v.add(node, "%s: expected %s, found %s", displayPath(path), strings.Join(expected, " or "), describeNode(node))
+		return
+	}
+
+	if node.Kind != s.kind || isNull(node) {
+		v.add(node, "%s: expected %s, found %s", displayPath(path), describeKind(s.kind), describeNode(node))
+		return
+	}
+
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if s.tag != "" && node.ShortTag() != s.tag {
+			v.add(node, "%s: expected %s, found '%s'", displayPath(path), scalarTagNames[s.tag], node.Value)
+		} else if len(s.enum) > 0 {
+			if _, found := util.IndexOfString(s.enum, node.Value); !found {
+				v.add(node, "%s: '%s' is not one of: %s", displayPath(path), node.Value, strings.Join(s.enum, ", "))
+			}
+		} else if s.check != nil {
+			if err := s.check(node.Value); err != nil {
+				v.add(node, "%s: %s", displayPath(path), err)
+			}
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			v.validate(item, s.items, fmt.Sprintf("%s[%d]", path, i))
+		}
+	case yaml.MappingNode:
+		seen := map[string]bool{}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			// Merge keys pull in anchored content validated at its definition.
+			if key.Tag == "!!merge" {
+				continue
+			}
+			childPath := joinPath(path, key.Value)
+			if seen[key.Value] {
+				v.add(key, "%s: duplicate key '%s'", displayPath(path), key.Value)
+				continue
+			}
+			seen[key.Value] = true
+
+			if s.values != nil {
+				v.validate(value, s.values, childPath)
+			} else if child, ok := s.properties[key.Value]; ok {
+				v.validate(value, child, childPath)
+			} else {
+				v.add(key, "%s: unknown key '%s'%s", displayPath(path), key.Value, suggestKey(key.Value, s.properties))
+			}
+		}
+		for _, name := range s.required {
+			if !seen[name] {
+				v.add(node, "%s: missing required key '%s'", displayPath(path), name)
+			}
+		}
+		if s.exclusive && len(seen) != 1 {
+			v.add(node, "%s: expected exactly one of: %s", displayPath(path), strings.Join(sortedKeys(s.properties), ", "))
+		}
+	}
+}
+
+// add records a problem at the position of the given node.
+func (v *schemaValidator) add(node *yaml.Node, format string, a ...interface{}) {
+	file := v.file
+	if source, ok := v.sources[node]; ok {
+		file = source
+	}
+	v.errors = append(v.errors, &ConfigError{
+		File:    file,
+		Line:    node.Line,
+		Column:  node.Column,
+		Message: fmt.Sprintf(format, a...),
+	})
+}
+
+// mappingValue finds the value node for a key in a mapping node.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return resolveAlias(node.Content[i+1])
+		}
+	}
+
+	return nil
+}
+
+// resolveAlias follows YAML aliases (*name) to the anchored node.
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+
+	return node
+}
+
+// isNull determines whether a node is an explicit or implied empty value.
+func isNull(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && node.Tag == "!!null"
+}
+
+// describeKind names a node kind for use in messages.
+func describeKind(kind yaml.Kind) string {
+	switch kind {
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a list"
+	default:
+		return "a value"
+	}
+}
+
+// describeNode names the kind of value found in a node for use in messages.
+func describeNode(node *yaml.Node) string {
+	if isNull(node) {
+		return "an empty value"
+	}
+
+	return describeKind(node.Kind)
+}
+
+// sortedKeys lists the property names of a schema in a stable order.
+func sortedKeys(properties map[string]*schema) []string {
+	keys := []string{}
+	for key := range properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// joinPath appends a key to a dotted property path.
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+// displayPath names a property path, with the document root shown as such.
+func displayPath(path string) string {
+	if path == "" {
+		return "top level"
+	}
+
+	return path
+}
+
+// suggestKey offers the closest known key when an unknown key looks like a typo.
+func suggestKey(key string, properties map[string]*schema) string {
+	best, bestDistance := "", 3
+	for name := range properties {
+		if distance := editDistance(key, name); distance < bestDistance || (distance == bestDistance && name < best) {
+			best, bestDistance = name, distance
+		}
+	}
+
+	if best == "" {
+		return ""
+	}
+
+	return fmt.Sprintf(" (did you mean '%s'?)", best)
+}
+
+// editDistance computes the Levenshtein distance between two strings.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+
+	return previous[len(b)]
+}
+
+// minInt returns the smallest of the given integers.
+func minInt(first int, rest ...int) int {
+	for _, n := range rest {
+		if n < first {
+			first = n
+		}
+	}
+
+	return first
+}
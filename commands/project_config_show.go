@@ -0,0 +1,108 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectConfigShow is the command for displaying the effective project configuration
+type ProjectConfigShow struct {
+	BaseCommand
+}
+
+// Commands returns the operations supported by this command
+func (cmd *ProjectConfigShow) Commands() []cli.Command {
+	show := cli.Command{
+		Name:        "config:show",
+		Usage:       "Show the effective project configuration.",
+		ArgsUsage:   "[optional path to config file]",
+		Description: "Prints the project configuration as merged from the configuration file, the files it includes and the local override file such as outrigger.local.yml. Each value is annotated with the file and line it came from.",
+		Before:      cmd.Before,
+		Action:      cmd.Run,
+	}
+
+	return []cli.Command{show}
+}
+
+// Run executes the `rig project config:show` command
+func (cmd *ProjectConfigShow) Run(ctx *cli.Context) error {
+	file := ctx.Args().First()
+	if file == "" {
+		var err error
+		if file, err = ProjectConfigFilePath(); err != nil {
+			return cmd.Failure(err.Error(), "PROJECT-CONFIG-NOT-FOUND", 12)
+		}
+	}
+
+	document, err := loadProjectConfigDocument(file)
+	if problems, invalid := err.(ConfigErrors); invalid {
+		for _, problem := range problems {
+			fmt.Fprintln(os.Stderr, problem)
+		}
+		return cmd.Failure(fmt.Sprintf("Project configuration %s could not be loaded", file), "PROJECT-CONFIG-INVALID", 12)
+	} else if err != nil {
+		return cmd.Failure(fmt.Sprintf("Could not read project configuration %s: %s", file, err), "PROJECT-CONFIG-NOT-FOUND", 12)
+	}
+
+	dir := filepath.Dir(file)
+	output, err := document.annotated(dir)
+	if err != nil {
+		return cmd.Failure(err.Error(), "PROJECT-CONFIG-INVALID", 12)
+	}
+
+	files := []string{}
+	for _, loaded := range document.files {
+		if relative, err := filepath.Rel(dir, loaded); err == nil {
+			loaded = relative
+		}
+		files = append(files, loaded)
+	}
+	fmt.Printf("# Merged from, in order of precedence: %s\n", strings.Join(files, ", "))
+	fmt.Print(string(output))
+
+	return cmd.Success("")
+}
+
+// annotated renders the merged configuration as YAML with the source of each
+// value as a comment.
+func (d *projectConfigDocument) annotated(dir string) ([]byte, error) {
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(d.annotate(d.root, dir)); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
+
+// annotate copies a node tree without its comments and styling, marking every
+// value with the file and line it was defined at.
+func (d *projectConfigDocument) annotate(node *yaml.Node, dir string) *yaml.Node {
+	node = resolveAlias(node)
+	annotated := &yaml.Node{Kind: node.Kind, Tag: node.Tag, Value: node.Value}
+	if node.Kind == yaml.ScalarNode {
+		annotated.Style = node.Style
+		annotated.LineComment = d.source(node, dir)
+		return annotated
+	}
+
+	for i, child := range node.Content {
+		if node.Kind == yaml.MappingNode && i%2 == 0 {
+			annotated.Content = append(annotated.Content, &yaml.Node{Kind: child.Kind, Tag: child.Tag, Value: child.Value, Style: child.Style})
+		} else {
+			annotated.Content = append(annotated.Content, d.annotate(child, dir))
+		}
+	}
+
+	return annotated
+}
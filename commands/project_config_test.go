@@ -0,0 +1,486 @@
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/phase2/rig/util"
+	"gopkg.in/yaml.v3"
+)
+
+func parseTestConfig(t *testing.T, content string) *yaml.Node {
+	var document yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &document); err != nil {
+		t.Fatal(err)
+	}
+	return &document
+}
+
+// newTestProject writes an outrigger.yml with the content to a temporary
+// project directory and points RIG_PROJECT_CONFIG_FILE at it. The returned
+// function removes the directory and unsets the variable.
+func newTestProject(t *testing.T, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "rig-project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "outrigger.yml")
+	if err = ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	os.Setenv("RIG_PROJECT_CONFIG_FILE", file)
+
+	return dir, func() {
+		os.Unsetenv("RIG_PROJECT_CONFIG_FILE")
+		os.RemoveAll(dir)
+	}
+}
+
+func TestExampleConfigIsValid(t *testing.T) {
+	for _, file := range []string{"../examples/outrigger.example.yml", "../examples/outrigger.v2.example.yml"} {
+		if config, err := NewProjectConfigFromFile(file); err != nil {
+			t.Errorf("example configuration %s should be valid: %s", file, err)
+		} else if config.Namespace != "myproject" {
+			t.Errorf("expected the project setting of %s to name the namespace, found %q", file, config.Namespace)
+		}
+	}
+}
+
+func TestSchemaReportsEveryProblem(t *testing.T) {
+	document := parseTestConfig(t, `version: 1.0
+scripts:
+  hello:
+    alais: hi
+    run:
+      - echo hello
+  broken:
+    description: No steps here.
+sync:
+  ignores:
+    - "Name *.log"
+`)
+
+	problems := ValidateProjectConfigSchema("outrigger.yml", document)
+	expected := []string{
+		"outrigger.yml:4:5: scripts.hello: unknown key 'alais' (did you mean 'alias'?)",
+		"outrigger.yml:8:5: scripts.broken: missing required key 'run'",
+		"outrigger.yml:10:3: sync: unknown key 'ignores' (did you mean 'ignore'?)",
+	}
+	if len(problems) != len(expected) {
+		t.Fatalf("expected %d problems, found %d:\n%s", len(expected), len(problems), problems)
+	}
+	for i, problem := range problems {
+		if problem.Error() != expected[i] {
+			t.Errorf("expected '%s', found '%s'", expected[i], problem)
+		}
+	}
+}
+
+func TestSchemaRejectsUnsupportedVersion(t *testing.T) {
+	problems := ValidateProjectConfigSchema("outrigger.yml", parseTestConfig(t, "version: 0.9\n"))
+	if len(problems) != 1 || !strings.Contains(problems[0].Message, "unsupported version '0.9'") {
+		t.Errorf("expected an unsupported version problem, found: %s", problems)
+	}
+}
+
+func TestSchemaFreezesVersion1(t *testing.T) {
+	document := parseTestConfig(t, `version: 1.0
+env:
+  APP_ENV: dev
+scripts:
+  hello:
+    depends: [setup]
+    run:
+      - echo hello
+sync:
+  driver: bind
+`)
+
+	problems := ValidateProjectConfigSchema("outrigger.yml", document)
+	expected := []string{
+		"outrigger.yml:2:1: top level: unknown key 'env'",
+		"outrigger.yml:6:5: scripts.hello: unknown key 'depends'",
+		"outrigger.yml:10:3: sync: unknown key 'driver'",
+	}
+	if len(problems) != len(expected) {
+		t.Fatalf("expected %d problems, found %d:\n%s", len(expected), len(problems), problems)
+	}
+	for i, problem := range problems {
+		if problem.Error() != expected[i] {
+			t.Errorf("expected '%s', found '%s'", expected[i], problem)
+		}
+	}
+}
+
+func TestMigratedExampleMatchesOriginal(t *testing.T) {
+	original, err := NewProjectConfigFromFile("../examples/outrigger.example.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile("../examples/outrigger.example.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrated, err := MigrateProjectConfig(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problems := ValidateProjectConfigSchema("migrated.yml", parseTestConfig(t, string(migrated))); len(problems) > 0 {
+		t.Fatalf("migrated configuration is invalid:\n%s", problems)
+	}
+
+	var config ProjectConfig
+	if err := yaml.Unmarshal(migrated, &config); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(config.Sync[0].Ignore, original.Sync[0].Ignore) {
+		t.Errorf("expected ignores %v, found %v", original.Sync[0].Ignore, config.Sync[0].Ignore)
+	}
+	for id, script := range original.Scripts {
+		if !reflect.DeepEqual(config.Scripts[id].Aliases, script.Aliases) {
+			t.Errorf("expected aliases %v for '%s', found %v", script.Aliases, id, config.Scripts[id].Aliases)
+		}
+		if !reflect.DeepEqual(config.Scripts[id].Steps, script.Steps) {
+			t.Errorf("expected steps %v for '%s', found %v", script.StepCommands(), id, config.Scripts[id].StepCommands())
+		}
+	}
+	if !strings.Contains(string(migrated), "# This controls configuration for the `project sync:start` command.") {
+		t.Error("expected comments to be preserved")
+	}
+}
+
+func TestScriptExecutionOrder(t *testing.T) {
+	config := &ProjectConfig{Scripts: map[string]*Script{
+		"install": {ID: "install"},
+		"build":   {ID: "build", Depends: []string{"install"}},
+		"migrate": {ID: "migrate", Depends: []string{"install", "build"}},
+		"seed":    {ID: "seed", Depends: []string{"migrate", "build"}},
+	}}
+
+	order, err := config.ScriptExecutionOrder(config.Scripts["seed"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, script := range order {
+		ids = append(ids, script.ID)
+	}
+	if strings.Join(ids, ",") != "install,build,migrate,seed" {
+		t.Errorf("unexpected execution order: %v", ids)
+	}
+
+	config.Scripts["install"].Depends = []string{"seed"}
+	if _, err := config.ScriptExecutionOrder(config.Scripts["seed"]); err == nil || !strings.Contains(err.Error(), "seed -> migrate -> install -> seed") {
+		t.Errorf("expected a dependency cycle, found: %v", err)
+	}
+
+	// Cycles are reported alongside other problems, even through unknown scripts.
+	config.Scripts["install"].Depends = []string{"missing", "seed"}
+	cycles := 0
+	problems := config.CheckProjectScripts(nil)
+	for _, problem := range problems {
+		if strings.Contains(problem.Message, "form a cycle") {
+			cycles++
+		}
+	}
+	if cycles != 1 || !strings.Contains(problems.Error(), "depends on unknown script 'missing'") {
+		t.Errorf("expected the unknown script and a single cycle to be reported, found: %s", problems)
+	}
+}
+
+func TestScriptArgs(t *testing.T) {
+	script := &Script{
+		ID: "deploy",
+		Args: []*ScriptArg{
+			{Name: "env", Required: true, Choices: []string{"dev", "prod"}},
+			{Name: "message", Default: "it's live"},
+		},
+		Steps: []*Step{{Run: "deploy.sh --env={{ env }} {{message}} {{ unknown }}"}},
+	}
+
+	if _, err := script.ArgValues(nil); err == nil || !strings.Contains(err.Error(), "requires the --env argument") {
+		t.Errorf("expected a missing required argument, found: %v", err)
+	}
+	if _, err := script.ArgValues(map[string]string{"env": "qa"}); err == nil || !strings.Contains(err.Error(), "must be one of: dev, prod") {
+		t.Errorf("expected an invalid choice, found: %v", err)
+	}
+
+	values, err := script.ArgValues(map[string]string{"env": "prod"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rendered := map[string]string{
+		"sh":     `deploy.sh --env=prod 'it'\''s live'`,
+		"pwsh":   `deploy.sh --env='prod' 'it''s live'`,
+		"python": `deploy.sh --env="prod" "it's live"`,
+	}
+	for name, expected := range rendered {
+		if step, err := RenderStep("deploy.sh --env={{ env }} {{message}}", values, shells[name]); err != nil || step != expected {
+			t.Errorf("expected step rendered for %s as %s, found %s (%v)", name, expected, step, err)
+		}
+	}
+	custom, _ := NewShell([]string{"node", "-e", "{command}"})
+	if _, err := RenderStep("deploy({{ env }})", values, custom); err == nil || !strings.Contains(err.Error(), "can not be quoted for the custom shell 'node'") {
+		t.Errorf("expected placeholders to be refused for a custom shell, found: %v", err)
+	}
+	if words, err := util.SplitShellArgs(RenderCall("--env={{ env }} {{message}}", values)); err != nil || !reflect.DeepEqual(words, []string{"--env=prod", "it's live"}) {
+		t.Errorf("expected the call arguments to split into the values, found %q (%v)", words, err)
+	}
+
+	config := &ProjectConfig{File: "outrigger.yml", Scripts: map[string]*Script{"deploy": script}}
+	if problems := config.checkScriptArgs(script); len(problems) != 1 || !strings.Contains(problems[0].Message, "undeclared argument 'unknown'") {
+		t.Errorf("expected an undeclared argument problem, found: %s", problems)
+	}
+
+	script.Shell = StringList{"node", "-e", "{command}"}
+	script.Steps = []*Step{{Run: "deploy({{ env }})"}, {Run: "@deploy --env={{ env }}"}}
+	if problems := config.checkScriptArgs(script); len(problems) != 1 || !strings.Contains(problems[0].Message, "can not be quoted for the custom shell 'node'") {
+		t.Errorf("expected a placeholder problem for the custom shell, found: %s", problems)
+	}
+}
+
+func TestProjectConfigIncludesAndLocalOverrides(t *testing.T) {
+	dir, cleanup := newTestProject(t, `version: 2.0
+include: [shared.yml]
+scripts:
+  hello:
+    steps: [echo hello]
+sync:
+  ignore:
+    - path: vendor/
+`)
+	defer cleanup()
+
+	files := map[string]string{
+		"shared.yml": `scripts:
+  build:
+    description: Shared build.
+    steps: [make]
+`,
+		"outrigger.local.yml": `scripts:
+  build:
+    description: My build.
+  mine:
+    steps: [echo mine]
+sync:
+  ignore:
+    - name: "*.swp"
+`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	file := filepath.Join(dir, "outrigger.yml")
+	config, err := NewProjectConfigFromFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Scripts) != 3 || config.Scripts["build"].Description != "My build." || config.Scripts["build"].Steps[0].Run != "make" {
+		t.Errorf("unexpected merged scripts: %v", config.Scripts)
+	}
+	if !reflect.DeepEqual([]string(config.Sync[0].Ignore), []string{"Name *.swp"}) {
+		t.Errorf("expected the local ignores to replace the others, found: %v", config.Sync[0].Ignore)
+	}
+
+	shared := filepath.Join(dir, "shared.yml")
+	if err := ioutil.WriteFile(shared, []byte("version: 1.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewProjectConfigFromFile(file); err == nil || !strings.Contains(err.Error(), "version '2.0' does not match version '1.0' of "+shared) {
+		t.Errorf("expected a version mismatch, found: %v", err)
+	}
+
+	if err := ioutil.WriteFile(file, []byte("version: 1.0\ninclude: [shared.yml]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewProjectConfigFromFile(file); err == nil || !strings.Contains(err.Error(), file+":2:1: include: not supported in version 1.0") {
+		t.Errorf("expected includes to be rejected in version 1.0, found: %v", err)
+	}
+}
+
+func TestSchemaChecksStepPolicies(t *testing.T) {
+	document := parseTestConfig(t, `version: 2.0
+scripts:
+  setup:
+    steps:
+      - name: install
+        run: composer install
+        timeout: 10 minutes
+        retries: -1
+`)
+
+	problems := ValidateProjectConfigSchema("outrigger.yml", document)
+	if len(problems) != 2 ||
+		problems[0].Error() != "outrigger.yml:7:18: scripts.setup.steps[0].timeout: expected a duration such as 90s or 10m, found '10 minutes'" ||
+		problems[1].Error() != "outrigger.yml:8:18: scripts.setup.steps[0].retries: expected zero or more, found '-1'" {
+		t.Errorf("unexpected problems:\n%s", problems)
+	}
+}
+
+func TestSchemaChecksConditions(t *testing.T) {
+	document := parseTestConfig(t, `version: 2.0
+scripts:
+  hosts:
+    when:
+      os: [linux, beos]
+      env: HOSTS_FILE
+    steps:
+      - run: update-hosts
+        when:
+          native_docker: maybe
+`)
+
+	problems := ValidateProjectConfigSchema("outrigger.yml", document)
+	if len(problems) != 2 ||
+		problems[0].Error() != "outrigger.yml:5:19: scripts.hosts.when.os[1]: 'beos' is not one of: linux, darwin, windows" ||
+		problems[1].Error() != "outrigger.yml:10:26: scripts.hosts.steps[0].when.native_docker: expected true or false, found 'maybe'" {
+		t.Errorf("unexpected problems:\n%s", problems)
+	}
+}
+
+func TestProjectConfigTrust(t *testing.T) {
+	dir, cleanup := newTestProject(t, "version: 2.0\nscripts:\n  hello:\n    steps: [echo hello]\n")
+	defer cleanup()
+	os.Setenv("RIG_STATE_DIR", filepath.Join(dir, "state"))
+	defer os.Unsetenv("RIG_STATE_DIR")
+
+	file := filepath.Join(dir, "outrigger.yml")
+	config, err := NewProjectConfigFromFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if trusted, err := ProjectConfigTrusted(config); err != nil || trusted {
+		t.Fatalf("expected new configuration not to be trusted, found %v (%v)", trusted, err)
+	}
+	if err = TrustProjectConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	if trusted, err := ProjectConfigTrusted(config); err != nil || !trusted {
+		t.Fatalf("expected configuration to be trusted, found %v (%v)", trusted, err)
+	}
+
+	if err = ioutil.WriteFile(file, []byte("version: 2.0\nscripts:\n  hello:\n    steps: [rm -rf /]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if trusted, err := ProjectConfigTrusted(config); err != nil || trusted {
+		t.Errorf("expected changed configuration not to be trusted, found %v (%v)", trusted, err)
+	}
+
+	// Env files and the files of the bin directory are trusted along with it.
+	content := "version: 2.0\nbin: bin\nenv_file: [.env]\nscripts:\n  hello:\n    env_file: [hello.env]\n    steps: [echo hello]\n"
+	if err = ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if config, err = NewProjectConfigFromFile(file); err != nil {
+		t.Fatal(err)
+	}
+	if err = TrustProjectConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	changes := map[string]string{
+		".env":      "TOKEN=1\n",
+		"hello.env": "GREETING=hi\n",
+		"bin/echo":  "#!/bin/sh\nrm -rf /\n",
+	}
+	for name, content := range changes {
+		if err = os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if trusted, err := ProjectConfigTrusted(config); err != nil || trusted {
+			t.Errorf("expected configuration not to be trusted after writing %s, found %v (%v)", name, trusted, err)
+		}
+		if err = TrustProjectConfig(config); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if removed, err := UntrustProjectConfig(config); err != nil || !removed {
+		t.Errorf("expected configuration to be untrusted, found %v (%v)", removed, err)
+	}
+}
+
+func TestRequiredRigVersion(t *testing.T) {
+	config := &ProjectConfig{File: "outrigger.yml", Requires: ">= 2.2, < 3"}
+	if err := config.CheckRequiredRigVersion("2.3.1"); err != nil {
+		t.Errorf("expected 2.3.1 to satisfy %s, found: %s", config.Requires, err)
+	}
+	if err := config.CheckRequiredRigVersion("master"); err != nil {
+		t.Errorf("expected development builds to be allowed, found: %s", err)
+	}
+
+	err := config.CheckRequiredRigVersion("2.1.0")
+	if mismatch, ok := err.(*RigVersionError); !ok || mismatch.Running != "2.1.0" {
+		t.Errorf("expected 2.1.0 to be rejected, found: %v", err)
+	}
+
+	_, cleanup := newTestProject(t, "version: 2.0\nrequires: \">= 2.2\"\n")
+	defer cleanup()
+	RigVersion = "2.1.0"
+	defer func() { RigVersion = "master" }()
+	if loaded, err := LoadProjectConfig(); loaded.NotEmpty() || !strings.Contains(fmt.Sprint(err), "requires rig >= 2.2, but this is rig 2.1.0") {
+		t.Errorf("expected loading the configuration to fail for 2.1.0, found: %v", err)
+	}
+}
+
+func TestLoadProjectConfigIsShared(t *testing.T) {
+	dir, cleanup := newTestProject(t, "version: 2.0\nnamespace: first\n")
+	defer cleanup()
+	file := filepath.Join(dir, "outrigger.yml")
+
+	loaded, err := LoadProjectConfig()
+	if err != nil || loaded.Namespace != "first" {
+		t.Fatalf("unexpected configuration %+v (%v)", loaded, err)
+	}
+	if err = ioutil.WriteFile(file, []byte("version: 2.0\nnamespace: second\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if again, err := LoadProjectConfig(); err != nil || again != loaded {
+		t.Errorf("expected the loaded configuration to be reused, found %+v (%v)", again, err)
+	}
+
+	os.Unsetenv("RIG_PROJECT_CONFIG_FILE")
+	if other, _ := LoadProjectConfig(); other == loaded {
+		t.Error("expected another file to be loaded afresh")
+	}
+}
+
+func TestShellCommand(t *testing.T) {
+	cases := []struct {
+		setting  []string
+		expected []string
+	}{
+		{[]string{"bash"}, []string{"bash", "-c", "echo a && echo b 'two words'"}},
+		{[]string{"pwsh"}, []string{"pwsh", "-NoProfile", "-Command", "echo a; echo b 'two words'"}},
+		{[]string{"cmd"}, []string{"cmd", "/s", "/c", `"echo a & echo b ^"two words^""`}},
+		{[]string{"python"}, []string{"python3", "-c", "echo a\necho b", "two words"}},
+		{[]string{"node", "-e", "{command}"}, []string{"node", "-e", "echo a\necho b", "two words"}},
+	}
+	for _, c := range cases {
+		shell, err := NewShell(c.setting)
+		if err != nil {
+			t.Errorf("unexpected problem with shell %v: %s", c.setting, err)
+			continue
+		}
+		if actual := shell.Command([]string{"echo a", "echo b"}, []string{"two words"}); !reflect.DeepEqual(actual, c.expected) {
+			t.Errorf("expected shell %v to run %q, found %q", c.setting, c.expected, actual)
+		}
+	}
+
+	if _, err := NewShell([]string{"node", "-e"}); err == nil {
+		t.Error("expected a custom shell without {command} to be rejected")
+	}
+}
@@ -0,0 +1,230 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// Markers delimiting the generated section of a file updated by `rig project docs --update`.
+const (
+	docsBeginMarker = "<!-- BEGIN rig project docs -->"
+	docsEndMarker   = "<!-- END rig project docs -->"
+)
+
+// ProjectDocs is the command for generating documentation of the project scripts and sync settings
+type ProjectDocs struct {
+	BaseCommand
+	Config *ProjectConfig
+}
+
+// Commands returns the operations supported by this command
+func (cmd *ProjectDocs) Commands() []cli.Command {
+	docs := cli.Command{
+		Name:        "docs",
+		Usage:       "Generate Markdown documentation of the project scripts.",
+		Description: fmt.Sprintf("Renders every project script with its description, aliases, arguments, dependencies and steps, followed by the sync settings, as Markdown. The documentation is printed unless written to a file with --output.\n\n\tWith --update the section of a file such as README.md between the lines\n\n\t%s\n\t%s\n\n\tis replaced, so the documentation can be regenerated whenever the configuration changes.", docsBeginMarker, docsEndMarker),
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "output",
+				Usage: "Write the documentation to this file.",
+			},
+			cli.StringFlag{
+				Name:  "update",
+				Usage: "Replace the marked documentation section of this file, such as README.md.",
+			},
+		},
+		Before: cmd.Before,
+		Action: cmd.Run,
+	}
+
+	return []cli.Command{docs}
+}
+
+// Run executes the `rig project docs` command
+func (cmd *ProjectDocs) Run(ctx *cli.Context) error {
+	if !cmd.Config.NotEmpty() {
+		return cmd.Failure("No valid project configuration was found. Run 'rig project validate' for details.", "PROJECT-CONFIG-NOT-FOUND", 12)
+	}
+
+	docs := ProjectConfigMarkdown(cmd.Config)
+	if file := ctx.String("update"); file != "" {
+		info, err := os.Stat(file)
+		if err != nil {
+			return cmd.Failure(fmt.Sprintf("Could not read %s: %s", file, err), "COMMAND-ERROR", 12)
+		}
+		content, err := ioutil.ReadFile(file) // nolint: gosec
+		if err != nil {
+			return cmd.Failure(fmt.Sprintf("Could not read %s: %s", file, err), "COMMAND-ERROR", 12)
+		}
+		updated, err := ReplaceDocsSection(string(content), docs)
+		if err != nil {
+			return cmd.Failure(fmt.Sprintf("Could not update %s: %s", file, err), "DOCS-MARKERS-NOT-FOUND", 12)
+		}
+		// The file keeps its permissions, such as those of a script.
+		if err := ioutil.WriteFile(file, []byte(updated), info.Mode().Perm()); err != nil {
+			return cmd.Failure(fmt.Sprintf("Could not write %s: %s", file, err), "COMMAND-ERROR", 12)
+		}
+		return cmd.Success(fmt.Sprintf("Updated the project documentation in %s", file))
+	}
+
+	if file := ctx.String("output"); file != "" {
+		if err := ioutil.WriteFile(file, []byte(docs), 0644); err != nil {
+			return cmd.Failure(fmt.Sprintf("Could not write %s: %s", file, err), "COMMAND-ERROR", 12)
+		}
+		return cmd.Success(fmt.Sprintf("Wrote the project documentation to %s", file))
+	}
+
+	fmt.Print(docs)
+	return nil
+}
+
+// ReplaceDocsSection replaces the lines between the documentation markers in
+// the content of a file, keeping the markers.
+func ReplaceDocsSection(content, docs string) (string, error) {
+	begin := strings.Index(content, docsBeginMarker)
+	end := strings.Index(content, docsEndMarker)
+	if begin < 0 || end < begin {
+		return "", fmt.Errorf("add the lines %s and %s where the documentation belongs", docsBeginMarker, docsEndMarker)
+	}
+
+	return content[:begin+len(docsBeginMarker)] + "\n" + docs + content[end:], nil
+}
+
+// ProjectConfigMarkdown documents the scripts and sync settings of a project
+// configuration as Markdown, with scripts ordered by id.
+func ProjectConfigMarkdown(config *ProjectConfig) string {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "## Project scripts\n\n")
+	fmt.Fprintf(&out, "Generated by `rig project docs` from %s. Run a script with `rig project run:<id>`, or one of its aliases.\n", filepath.Base(config.File))
+
+	ids := []string{}
+	for id := range config.Scripts {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		script := config.Scripts[id]
+		fmt.Fprintf(&out, "\n### %s\n\n%s\n", id, script.Description)
+
+		details := []string{}
+		if len(script.Aliases) > 0 {
+			details = append(details, "Aliases: "+markdownCodeList(script.Aliases))
+		}
+		if len(script.Depends) > 0 {
+			details = append(details, "Runs first: "+markdownCodeList(script.Depends))
+		}
+		if script.Service != "" {
+			details = append(details, "Runs in the docker-compose service "+markdownCode(script.Service))
+		} else if script.Container != "" {
+			details = append(details, "Runs in the container "+markdownCode(script.Container))
+		}
+		if script.Dir != "" {
+			details = append(details, "Runs in the directory "+markdownCode(script.Dir))
+		}
+		if len(details) > 0 {
+			fmt.Fprintf(&out, "\n- %s\n", strings.Join(details, "\n- "))
+		}
+
+		if len(script.Args) > 0 {
+			fmt.Fprintf(&out, "\n| Argument | Description | Default | Required |\n| --- | --- | --- | --- |\n")
+			for _, arg := range script.Args {
+				description := arg.Description
+				if len(arg.Choices) > 0 {
+					description = strings.TrimSpace(fmt.Sprintf("%s (one of: %s)", description, strings.Join(arg.Choices, ", ")))
+				}
+				defaultValue, required := "", "no"
+				if arg.Default != "" {
+					defaultValue = markdownCode(arg.Default)
+				}
+				if arg.Required {
+					required = "yes"
+				}
+				fmt.Fprintf(&out, "| %s | %s | %s | %s |\n", markdownCode("--"+arg.Name), markdownCell(description), markdownCell(defaultValue), required)
+			}
+		}
+
+		if script.Parallel {
+			fmt.Fprintf(&out, "\nSteps, run at the same time:\n\n")
+		} else {
+			fmt.Fprintf(&out, "\nSteps:\n\n")
+		}
+		for i, step := range script.Steps {
+			line := markdownCode(step.Run)
+			if step.Name != "" {
+				line = fmt.Sprintf("%s: %s", step.Name, line)
+			}
+			fmt.Fprintf(&out, "%d. %s\n", i+1, line)
+		}
+	}
+
+	fmt.Fprintf(&out, "\n## File sync\n")
+	if len(config.Sync) == 0 {
+		fmt.Fprintf(&out, "\nFiles are synced to the external `*-sync` volume of the docker-compose file, or a volume named after the project directory.\n")
+	}
+	for _, mapping := range config.Sync {
+		directory := "The project directory"
+		if mapping.Path != "" {
+			directory = "The directory " + markdownCode(mapping.Path)
+		}
+		if mapping.Volume != "" {
+			fmt.Fprintf(&out, "\n%s is synced to the volume %s", directory, markdownCode(mapping.Volume))
+		} else {
+			fmt.Fprintf(&out, "\n%s is synced to the external `*-sync` volume of the docker-compose file, or a volume named after the project directory", directory)
+		}
+		if mapping.Driver != "" {
+			fmt.Fprintf(&out, " by the %s sync driver", markdownCode(mapping.Driver))
+		}
+		fmt.Fprintf(&out, ".\n")
+		if len(mapping.Ignore) > 0 {
+			fmt.Fprintf(&out, "\nIgnored by unison:\n\n")
+			for _, rule := range mapping.Ignore {
+				fmt.Fprintf(&out, "- %s\n", markdownCode(rule))
+			}
+		}
+		if len(mapping.IgnoreFrom) > 0 {
+			fmt.Fprintf(&out, "\nAlso ignored by unison are the patterns of:\n\n")
+			for _, file := range mapping.IgnoreFrom {
+				fmt.Fprintf(&out, "- %s\n", markdownCode(file))
+			}
+		}
+	}
+
+	return out.String()
+}
+
+// markdownCode formats a value as inline code, using enough backticks to
+// contain any within the value.
+func markdownCode(value string) string {
+	fence := "`"
+	for strings.Contains(value, fence) {
+		fence += "`"
+	}
+	if strings.HasPrefix(value, "`") || strings.HasSuffix(value, "`") {
+		value = " " + value + " "
+	}
+
+	return fence + value + fence
+}
+
+// markdownCodeList formats each value as inline code, separated by commas.
+func markdownCodeList(values []string) string {
+	formatted := make([]string, len(values))
+	for i, value := range values {
+		formatted[i] = markdownCode(value)
+	}
+
+	return strings.Join(formatted, ", ")
+}
+
+// markdownCell escapes a value for use in a table cell.
+func markdownCell(value string) string {
+	return strings.Replace(value, "|", `\|`, -1)
+}
@@ -0,0 +1,37 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProjectDocsSection(t *testing.T) {
+	config := &ProjectConfig{
+		File: "outrigger.yml",
+		Scripts: map[string]*Script{
+			"deploy": {
+				Description: "Deploy the site.",
+				Aliases:     []string{"ship"},
+				Args:        []*ScriptArg{{Name: "env", Description: "Where to | deploy.", Required: true}},
+				Steps:       []*Step{{Run: "deploy.sh --env={{ env }}"}},
+			},
+		},
+		Sync: SyncMappings{{Volume: "site-sync", Ignore: SyncIgnores{"Path vendor/"}}},
+	}
+
+	docs := ProjectConfigMarkdown(config)
+	for _, expected := range []string{"### deploy\n\nDeploy the site.\n", "- Aliases: `ship`", "| `--env` | Where to \\| deploy. |  | yes |", "1. `deploy.sh --env={{ env }}`", "volume `site-sync`", "- `Path vendor/`"} {
+		if !strings.Contains(docs, expected) {
+			t.Errorf("expected the documentation to contain %q:\n%s", expected, docs)
+		}
+	}
+
+	readme := "# Site\n\n" + docsBeginMarker + "\nold\n" + docsEndMarker + "\n\nMore.\n"
+	updated, err := ReplaceDocsSection(readme, "new\n")
+	if err != nil || updated != "# Site\n\n"+docsBeginMarker+"\nnew\n"+docsEndMarker+"\n\nMore.\n" {
+		t.Errorf("unexpected section update (%v):\n%s", err, updated)
+	}
+	if _, err := ReplaceDocsSection("# Site\n", "new\n"); err == nil {
+		t.Error("expected a file without markers to be rejected")
+	}
+}
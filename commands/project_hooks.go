@@ -0,0 +1,71 @@
+package commands
+
+import (
+	"fmt"
+)
+
+// HookEvents lists the built-in commands project hooks can be attached to.
+var HookEvents = []string{"start", "stop", "sync:start", "sync:stop", "sync:purge", "data-backup", "upgrade"}
+
+// WithProjectHooks runs a command between the pre and post hooks configured
+// for the event in the project configuration already loaded for the run, if
+// there is one. A failing pre hook prevents the command from running and post
+// hooks only run once the command succeeded. Hooks only run from trusted
+// project configuration, and not for commands nested in another, such as the
+// stop run by kill.
+func (cmd *BaseCommand) WithProjectHooks(event string, command func() error) error {
+	if cmd.nested {
+		cmd.out.Verbose("Skipping project hooks for '%s', it runs as part of another command", event)
+		return command()
+	}
+
+	config, err := LoadProjectConfig()
+	if err != nil && event == "upgrade" {
+		// Upgrading rig is the way to support the configuration, so it is not
+		// stopped, but its hooks can not be run.
+		cmd.out.Warning("%s. Upgrading without project hooks", err)
+		return command()
+	} else if err != nil {
+		return cmd.Failure(err.Error(), "RIG-VERSION-UNSUPPORTED", 12)
+	}
+	hook := config.Hooks[event]
+	if hook == nil {
+		return command()
+	}
+	if err := cmd.CheckProjectTrust(config); err != nil {
+		return err
+	}
+
+	if failure := cmd.runHookScripts(config, event, "pre", hook.Pre); failure != nil {
+		return cmd.Failure(failure.Message, "PRE-HOOK-FAILED", failure.ExitCode)
+	}
+
+	if err := command(); err != nil {
+		return err
+	}
+
+	if failure := cmd.runHookScripts(config, event, "post", hook.Post); failure != nil {
+		return cmd.Failure(failure.Message, "POST-HOOK-FAILED", failure.ExitCode)
+	}
+
+	return nil
+}
+
+// runHookScripts runs the project scripts of a hook in order.
+func (cmd *BaseCommand) runHookScripts(config *ProjectConfig, event, stage string, ids []string) *ScriptFailure {
+	scripts := ProjectScript{out: cmd.out, config: config}
+	for _, id := range ids {
+		script := config.Scripts[id]
+		if script == nil {
+			return &ScriptFailure{fmt.Sprintf("The %s-%s hook refers to unknown project script '%s'", stage, event, id), "SCRIPT-NOT-FOUND", 12}
+		}
+
+		cmd.out.Info("Running %s-%s hook: %s", stage, event, id)
+		if failure := scripts.Run(script, nil, nil); failure != nil {
+			failure.Message = fmt.Sprintf("%s in the %s-%s hook", failure.Message, stage, event)
+			return failure
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package commands
+
+import (
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/phase2/rig/util"
+	"github.com/urfave/cli"
+)
+
+func TestProjectHooksOnlyFireForTheTypedCommand(t *testing.T) {
+	dir, cleanup := newTestProject(t, `version: 2.0
+shell: sh
+scripts:
+  before:
+    steps: [echo pre-$EVENT >> hooks.log]
+  after:
+    steps: [echo post-$EVENT >> hooks.log]
+hooks:
+  stop:
+    pre: [before]
+    post: [after]
+  data-backup:
+    pre: [before]
+`)
+	defer cleanup()
+	os.Setenv("RIG_PROJECT_TRUST", "1")
+	defer os.Unsetenv("RIG_PROJECT_TRUST")
+	defer os.Unsetenv("EVENT")
+
+	run := func(cmd *BaseCommand, event string) {
+		os.Setenv("EVENT", event)
+		ran := false
+		if err := cmd.WithProjectHooks(event, func() error { ran = true; return nil }); err != nil || !ran {
+			t.Fatalf("expected %s to run, found %v (%v)", event, ran, err)
+		}
+	}
+
+	// Kill stops the machine and upgrade backs up its data, as nested commands.
+	typed := &BaseCommand{out: util.Logger()}
+	run(typed, "stop")
+	kill := Kill{*typed}
+	stop := Stop{kill.Nested()}
+	run(&stop.BaseCommand, "stop")
+	upgrade := Upgrade{*typed}
+	backup := DataBackup{upgrade.Nested()}
+	run(&backup.BaseCommand, "data-backup")
+
+	log, err := ioutil.ReadFile(filepath.Join(dir, "hooks.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(log) != "pre-stop\npost-stop\n" {
+		t.Errorf("expected the hooks to fire for the typed stop only, found %q", log)
+	}
+}
+
+func TestProjectHooksDispatch(t *testing.T) {
+	dir, cleanup := newTestProject(t, `version: 2.0
+shell: sh
+scripts:
+  before:
+    steps: [echo pre >> hooks.log]
+  after:
+    steps: [echo post >> hooks.log]
+  broken:
+    steps: [exit 7]
+hooks:
+  start:
+    pre: [before]
+    post: [after]
+  stop:
+    pre: [broken]
+    post: [after]
+`)
+	defer cleanup()
+	os.Setenv("RIG_PROJECT_TRUST", "1")
+	defer os.Unsetenv("RIG_PROJECT_TRUST")
+
+	hooksLog := func() string {
+		log, err := ioutil.ReadFile(filepath.Join(dir, "hooks.log"))
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		os.Remove(filepath.Join(dir, "hooks.log"))
+		return string(log)
+	}
+	// Failures are reported quietly, without troubleshooting help.
+	flags := flag.NewFlagSet("rig", flag.ContinueOnError)
+	flags.Bool("quiet", true, "")
+	flags.Bool("power-user", true, "")
+	cmd := &BaseCommand{out: util.Logger(), context: cli.NewContext(cli.NewApp(), flags, nil)}
+
+	ran := ""
+	if err := cmd.WithProjectHooks("start", func() error { ran = hooksLog(); return nil }); err != nil {
+		t.Errorf("expected start to succeed, found %v", err)
+	}
+	if log := hooksLog(); ran != "pre\n" || log != "post\n" {
+		t.Errorf("expected the pre hook before start and the post hook after it, found %q then %q", ran, log)
+	}
+
+	failed := errors.New("start failed")
+	if err := cmd.WithProjectHooks("start", func() error { return failed }); err != failed {
+		t.Errorf("expected the failure of start to be returned, found %v", err)
+	}
+	if log := hooksLog(); log != "pre\n" {
+		t.Errorf("expected no post hook after start failed, found %q", log)
+	}
+
+	called := false
+	err := cmd.WithProjectHooks("stop", func() error { called = true; return nil })
+	if exitErr, ok := err.(*cli.ExitError); !ok || exitErr.ExitCode() != 7 || called {
+		t.Errorf("expected the failing pre hook to stop the command with its exit code, found %v (ran %v)", err, called)
+	}
+	if log := hooksLog(); log != "" {
+		t.Errorf("expected no post hook after the pre hook failed, found %q", log)
+	}
+}
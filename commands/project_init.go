@@ -0,0 +1,388 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/phase2/rig/util"
+	"github.com/urfave/cli"
+	yamlv2 "gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectInit is the command for scaffolding a project configuration from an existing repository
+type ProjectInit struct {
+	BaseCommand
+
+	// Reserved holds the built-in project subcommands scripts may not shadow.
+	Reserved []cli.Command
+}
+
+// initScript is a project script suggested by `rig project init`.
+type initScript struct {
+	ID          string
+	Description string
+	Run         []string
+}
+
+// initSuggestion groups the scripts suggested from one source, such as a
+// Makefile, which are accepted or declined together.
+type initSuggestion struct {
+	Source  string
+	Prefix  string
+	Scripts []*initScript
+}
+
+// makeTarget matches a Makefile rule, ignoring special targets such as .PHONY,
+// pattern rules and variable assignments.
+var makeTarget = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9_.-]*)\s*:([^=]|$)`)
+
+// Commands returns the operations supported by this command
+func (cmd *ProjectInit) Commands() []cli.Command {
+	initialize := cli.Command{
+		Name:        "init",
+		Usage:       "Create a project configuration for an existing repository.",
+		ArgsUsage:   "[optional project directory]",
+		Description: "Inspects the project directory for docker-compose files and their external *-sync volume, a bin directory, Makefile targets and package.json scripts, and writes a version 1.0 outrigger.yml with the suggested scripts and sync settings.\n\n\tEach group of suggestions is offered for approval when run in a terminal. Use --yes to accept them all, such as from another script.",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "file",
+				Value: "outrigger.yml",
+				Usage: "Name of the configuration file to write in the project directory.",
+			},
+			cli.StringFlag{
+				Name:  "namespace",
+				Usage: "Project namespace. Defaults to the name of the project directory.",
+			},
+			cli.StringFlag{
+				Name:  "volume",
+				Usage: "Volume to sync files to. Defaults to the external *-sync volume of the docker-compose file.",
+			},
+			cli.BoolFlag{
+				Name:  "yes",
+				Usage: "Accept every suggestion without asking.",
+			},
+			cli.BoolFlag{
+				Name:  "force",
+				Usage: "Replace an existing project configuration.",
+			},
+			cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Print the configuration instead of writing it.",
+			},
+		},
+		Before: cmd.Before,
+		Action: cmd.Run,
+	}
+
+	return []cli.Command{initialize}
+}
+
+// Run executes the `rig project init` command
+func (cmd *ProjectInit) Run(ctx *cli.Context) error {
+	dir := ctx.Args().First()
+	if dir == "" {
+		dir = "."
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return cmd.Failure(err.Error(), "COMMAND-ERROR", 12)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return cmd.Failure(fmt.Sprintf("Project directory %s does not exist", dir), "COMMAND-ERROR", 12)
+	}
+
+	file := filepath.Join(dir, ctx.String("file"))
+	if !ctx.Bool("force") && !ctx.Bool("dry-run") {
+		for _, existing := range []string{file, filepath.Join(dir, "outrigger.yml"), filepath.Join(dir, ".outrigger.yml")} {
+			if _, err := os.Stat(existing); err == nil {
+				return cmd.Failure(fmt.Sprintf("Project configuration %s already exists. Use --force to replace it", existing), "PROJECT-CONFIG-EXISTS", 12)
+			}
+		}
+	}
+
+	ask := !ctx.Bool("yes") && util.StdinIsTerminal()
+	accept := func(question string) bool {
+		return !ask || util.AskYesNo(question)
+	}
+
+	namespace := ctx.String("namespace")
+	if namespace == "" {
+		namespace = filepath.Base(dir)
+	}
+
+	taken := map[string]bool{}
+	for _, subcommand := range cmd.Reserved {
+		taken[subcommand.Name] = true
+		for _, alias := range subcommand.Aliases {
+			taken[alias] = true
+		}
+	}
+
+	compose := cmd.loadComposeFile(dir)
+	scripts := []*initScript{}
+	for _, suggestion := range cmd.suggestScripts(dir, compose) {
+		if len(suggestion.Scripts) == 0 {
+			continue
+		}
+		ids := make([]string, len(suggestion.Scripts))
+		for i, script := range suggestion.Scripts {
+			ids[i] = script.ID
+		}
+		if !accept(fmt.Sprintf("Add %d script(s) for %s (%s)", len(ids), suggestion.Source, strings.Join(ids, ", "))) {
+			continue
+		}
+		for _, script := range suggestion.Scripts {
+			if taken[script.ID] {
+				script.ID = suggestion.Prefix + script.ID
+			}
+			if taken[script.ID] {
+				cmd.out.Warning("Skipping the script '%s' from %s, the name is already used", script.ID, suggestion.Source)
+				continue
+			}
+			taken[script.ID] = true
+			scripts = append(scripts, script)
+		}
+	}
+
+	volume := ctx.String("volume")
+	if volume == "" && compose != nil {
+		if name := compose.SyncVolume(); name != "" && accept(fmt.Sprintf("Sync files to the volume '%s'", name)) {
+			volume = name
+		}
+	}
+	ignores := []string{}
+	for _, name := range []string{".git", ".idea", "node_modules"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			ignores = append(ignores, "Name "+name)
+		}
+	}
+	if len(ignores) > 0 && !accept(fmt.Sprintf("Leave %s out of the file sync", strings.Join(ignores, ", "))) {
+		ignores = nil
+	}
+
+	bin := ""
+	if info, err := os.Stat(filepath.Join(dir, "bin")); err == nil && info.IsDir() {
+		bin = "./bin"
+	}
+
+	content, err := projectInitConfig(namespace, bin, scripts, volume, ignores)
+	if err != nil {
+		return cmd.Failure(err.Error(), "COMMAND-ERROR", 12)
+	}
+
+	// Make sure the result loads before writing it.
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return cmd.Failure(err.Error(), "COMMAND-ERROR", 12)
+	}
+	if problems := ValidateProjectConfigSchema(file, &document); len(problems) > 0 {
+		for _, problem := range problems {
+			fmt.Fprintln(os.Stderr, problem)
+		}
+		return cmd.Failure("The generated project configuration is invalid", "PROJECT-CONFIG-INVALID", 12)
+	}
+
+	if ctx.Bool("dry-run") {
+		fmt.Print(string(content))
+		return nil
+	}
+
+	if err := ioutil.WriteFile(file, content, 0644); err != nil {
+		return cmd.Failure(fmt.Sprintf("Could not write %s: %s", file, err), "COMMAND-ERROR", 12)
+	}
+	if added, err := IgnoreLocalProjectConfig(file); err != nil {
+		cmd.out.Warning("Could not add the local overrides file to .gitignore: %s", err)
+	} else if added != "" {
+		cmd.out.Info("Added %s to .gitignore for personal overrides", added)
+	}
+	cmd.out.Info("Review the scripts, then upgrade to version 2.0 with 'rig project config:migrate' when ready")
+
+	return cmd.Success(fmt.Sprintf("Wrote project configuration %s with %d script(s)", file, len(scripts)))
+}
+
+// suggestScripts inspects the project directory for scripts worth running
+// through rig, in order of preference when names collide.
+func (cmd *ProjectInit) suggestScripts(dir string, compose *ComposeFile) []*initSuggestion {
+	suggestions := []*initSuggestion{}
+
+	if compose != nil && len(compose.Services) > 0 {
+		suggestions = append(suggestions, &initSuggestion{
+			Source: "docker-compose",
+			Prefix: "compose-",
+			Scripts: []*initScript{
+				{"up", "Start the docker-compose services.", []string{"docker-compose up -d"}},
+				{"stop", "Stop the docker-compose services.", []string{"docker-compose stop"}},
+				{"ps", "List the docker-compose services.", []string{"docker-compose ps"}},
+				{"logs", "Follow the logs of the docker-compose services.", []string{"docker-compose logs -f"}},
+			},
+		})
+	}
+
+	if files, err := ioutil.ReadDir(filepath.Join(dir, "bin")); err == nil {
+		suggestion := &initSuggestion{Source: "bin/", Prefix: "bin-"}
+		for _, file := range files {
+			if file.IsDir() || file.Mode()&0111 == 0 || strings.HasPrefix(file.Name(), ".") {
+				continue
+			}
+			id := strings.TrimSuffix(file.Name(), filepath.Ext(file.Name()))
+			suggestion.Scripts = append(suggestion.Scripts, &initScript{id, fmt.Sprintf("Run bin/%s.", file.Name()), []string{file.Name()}})
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+
+	if targets, err := makefileTargets(filepath.Join(dir, "Makefile")); err == nil {
+		suggestion := &initSuggestion{Source: "Makefile", Prefix: "make-"}
+		for _, target := range targets {
+			suggestion.Scripts = append(suggestion.Scripts, &initScript{target, fmt.Sprintf("Make the '%s' target.", target), []string{"make " + target}})
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+
+	if names, err := packageScripts(filepath.Join(dir, "package.json")); err == nil {
+		suggestion := &initSuggestion{Source: "package.json", Prefix: "npm-"}
+		for _, name := range names {
+			suggestion.Scripts = append(suggestion.Scripts, &initScript{name, fmt.Sprintf("Run the '%s' npm script.", name), []string{"npm run " + name}})
+		}
+		suggestions = append(suggestions, suggestion)
+	} else if !os.IsNotExist(err) {
+		cmd.out.Warning("Could not read the scripts of package.json: %s", err)
+	}
+
+	return suggestions
+}
+
+// loadComposeFile reads the docker-compose file of the project directory, if
+// there is one.
+func (cmd *ProjectInit) loadComposeFile(dir string) *ComposeFile {
+	for _, name := range []string{"docker-compose.yml", "docker-compose.yaml"} {
+		content, err := ioutil.ReadFile(filepath.Join(dir, name)) // nolint: gosec
+		if err != nil {
+			continue
+		}
+		var compose ComposeFile
+		if err := yamlv2.Unmarshal(content, &compose); err != nil {
+			cmd.out.Warning("Could not read %s: %s", name, err)
+			return nil
+		}
+		return &compose
+	}
+
+	return nil
+}
+
+// makefileTargets lists the targets of a Makefile in the order they are
+// defined.
+func makefileTargets(file string) ([]string, error) {
+	content, err := ioutil.ReadFile(file) // nolint: gosec
+	if err != nil {
+		return nil, err
+	}
+
+	targets := []string{}
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		if match := makeTarget.FindStringSubmatch(scanner.Text()); match != nil && !seen[match[1]] {
+			seen[match[1]] = true
+			targets = append(targets, match[1])
+		}
+	}
+
+	return targets, scanner.Err()
+}
+
+// packageScripts lists the scripts of a package.json by name, leaving out the
+// pre and post scripts npm runs around others.
+func packageScripts(file string) ([]string, error) {
+	content, err := ioutil.ReadFile(file) // nolint: gosec
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest struct {
+		Scripts map[string]string `json:"scripts"`
+	}
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for name := range manifest.Scripts {
+		_, pre := manifest.Scripts[strings.TrimPrefix(name, "pre")]
+		_, post := manifest.Scripts[strings.TrimPrefix(name, "post")]
+		if (strings.HasPrefix(name, "pre") && pre) || (strings.HasPrefix(name, "post") && post) {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// projectInitConfig renders a version 1.0 project configuration.
+func projectInitConfig(namespace, bin string, scripts []*initScript, volume string, ignores []string) ([]byte, error) {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	add := func(parent *yaml.Node, key string, value *yaml.Node, comment string) {
+		parent.Content = append(parent.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key, HeadComment: comment}, value)
+	}
+	scalar := func(value string) *yaml.Node {
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+	}
+	list := func(values []string) *yaml.Node {
+		node := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, value := range values {
+			node.Content = append(node.Content, scalar(value))
+		}
+		return node
+	}
+
+	add(root, "version", &yaml.Node{Kind: yaml.ScalarNode, Value: "1.0", Tag: "!!float"}, "Generated by 'rig project init'. Check it with 'rig project validate' and\nupgrade it with 'rig project config:migrate'.")
+	add(root, "project", scalar(namespace), "")
+	if bin != "" {
+		add(root, "bin", scalar(bin), "Scripts in this directory can be run without their path.")
+	}
+
+	if len(scripts) > 0 {
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		for _, script := range scripts {
+			definition := &yaml.Node{Kind: yaml.MappingNode}
+			add(definition, "description", scalar(script.Description), "")
+			add(definition, "run", list(script.Run), "")
+			add(node, script.ID, definition, "")
+		}
+		add(root, "scripts", node, "Run a script with 'rig project run:<id>'.")
+	}
+
+	if volume != "" || len(ignores) > 0 {
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		if volume != "" {
+			add(node, "volume", scalar(volume), "")
+		}
+		if len(ignores) > 0 {
+			add(node, "ignore", list(ignores), "")
+		}
+		add(root, "sync", node, "Settings for 'rig project sync:start'.")
+	}
+
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(root); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
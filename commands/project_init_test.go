@@ -0,0 +1,49 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestProjectInitConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rig-init")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	makefile := filepath.Join(dir, "Makefile")
+	if err := ioutil.WriteFile(makefile, []byte(".PHONY: build\nVERSION := 1\nbuild: deps\n\tgo build\n%.o: %.c\ntest:\n\tgo test\nbuild:\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if targets, err := makefileTargets(makefile); err != nil || !reflect.DeepEqual(targets, []string{"build", "test"}) {
+		t.Errorf("unexpected Makefile targets (%v): %v", err, targets)
+	}
+
+	manifest := filepath.Join(dir, "package.json")
+	if err := ioutil.WriteFile(manifest, []byte(`{"scripts": {"test": "jest", "pretest": "eslint .", "prettier": "prettier ."}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if names, err := packageScripts(manifest); err != nil || !reflect.DeepEqual(names, []string{"prettier", "test"}) {
+		t.Errorf("unexpected package.json scripts (%v): %v", err, names)
+	}
+
+	content, err := projectInitConfig("site", "./bin", []*initScript{{"build:css", "Run the 'build:css' npm script.", []string{"npm run build:css"}}}, "site-sync", []string{"Name .git"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "outrigger.yml")
+	if err := ioutil.WriteFile(file, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := NewProjectConfigFromFile(file)
+	if err != nil {
+		t.Fatalf("expected the generated configuration to be valid: %s\n%s", err, content)
+	}
+	if config.Version != "1.0" || config.Scripts["build:css"] == nil || config.Sync[0].Volume != "site-sync" {
+		t.Errorf("unexpected generated configuration:\n%s", content)
+	}
+}
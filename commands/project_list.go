@@ -0,0 +1,155 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectList is the command for listing the configured project scripts
+type ProjectList struct {
+	BaseCommand
+	Config *ProjectConfig
+}
+
+// scriptListing describes a project script for tools consuming `rig project list`.
+type scriptListing struct {
+	ID          string         `json:"id" yaml:"id"`
+	Aliases     []string       `json:"aliases" yaml:"aliases"`
+	Description string         `json:"description" yaml:"description"`
+	Steps       []*stepListing `json:"steps" yaml:"steps"`
+	Args        []*argListing  `json:"args" yaml:"args"`
+	File        string         `json:"file" yaml:"file"`
+}
+
+// stepListing describes a step of a listed script.
+type stepListing struct {
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	Run  string `json:"run" yaml:"run"`
+}
+
+// argListing describes a named argument of a listed script.
+type argListing struct {
+	Name        string   `json:"name" yaml:"name"`
+	Description string   `json:"description,omitempty" yaml:"description,omitempty"`
+	Required    bool     `json:"required" yaml:"required"`
+	Default     string   `json:"default,omitempty" yaml:"default,omitempty"`
+	Choices     []string `json:"choices,omitempty" yaml:"choices,omitempty"`
+}
+
+// Commands returns the operations supported by this command
+func (cmd *ProjectList) Commands() []cli.Command {
+	list := cli.Command{
+		Name:        "list",
+		Usage:       "List the configured project scripts.",
+		Description: "Lists every script of the project configuration with its aliases, description, steps, arguments and the file it was configured in. Use --format json or yaml for editor integrations and other tools.",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "format",
+				Value: "table",
+				Usage: "Output format: table, json or yaml.",
+			},
+		},
+		Before: cmd.Before,
+		Action: cmd.Run,
+	}
+
+	return []cli.Command{list}
+}
+
+// Run executes the `rig project list` command
+func (cmd *ProjectList) Run(ctx *cli.Context) error {
+	if !cmd.Config.NotEmpty() {
+		return cmd.Failure("No valid project configuration was found. Run 'rig project validate' for details.", "PROJECT-CONFIG-NOT-FOUND", 12)
+	}
+
+	listings := cmd.listings()
+	switch format := ctx.String("format"); format {
+	case "table":
+		cmd.printTable(listings)
+	case "json":
+		output, err := json.MarshalIndent(listings, "", "  ")
+		if err != nil {
+			return cmd.Failure(err.Error(), "COMMAND-ERROR", 12)
+		}
+		fmt.Println(string(output))
+	case "yaml":
+		output, err := yaml.Marshal(listings)
+		if err != nil {
+			return cmd.Failure(err.Error(), "COMMAND-ERROR", 12)
+		}
+		fmt.Print(string(output))
+	default:
+		return cmd.Failure(fmt.Sprintf("Unknown format '%s', expected table, json or yaml", format), "INVALID-FORMAT", 12)
+	}
+
+	return nil
+}
+
+// listings describes every configured script, ordered by id.
+func (cmd *ProjectList) listings() []*scriptListing {
+	ids := []string{}
+	for id := range cmd.Config.Scripts {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	listings := []*scriptListing{}
+	for _, id := range ids {
+		script := cmd.Config.Scripts[id]
+		file := script.file
+		if file == "" {
+			file = cmd.Config.File
+		}
+		if absolute, err := filepath.Abs(file); err == nil {
+			file = absolute
+		}
+
+		listing := &scriptListing{
+			ID:          id,
+			Aliases:     append([]string{}, script.Aliases...),
+			Description: script.Description,
+			Steps:       []*stepListing{},
+			Args:        []*argListing{},
+			File:        file,
+		}
+		for _, step := range script.Steps {
+			listing.Steps = append(listing.Steps, &stepListing{step.Name, step.Run})
+		}
+		for _, arg := range script.Args {
+			listing.Args = append(listing.Args, &argListing{arg.Name, arg.Description, arg.Required, arg.Default, arg.Choices})
+		}
+		listings = append(listings, listing)
+	}
+
+	return listings
+}
+
+// printTable prints a summary of the scripts as aligned columns.
+func (cmd *ProjectList) printTable(listings []*scriptListing) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "ID\tALIASES\tDESCRIPTION\tSTEPS\tARGS\tFILE")
+	for _, listing := range listings {
+		args := []string{}
+		for _, arg := range listing.Args {
+			if arg.Required {
+				args = append(args, "--"+arg.Name+"*")
+			} else {
+				args = append(args, "--"+arg.Name)
+			}
+		}
+		file := listing.File
+		if relative, err := filepath.Rel(filepath.Dir(cmd.Config.Path), file); err == nil && !strings.HasPrefix(relative, "..") {
+			file = relative
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%d\t%s\t%s\n", listing.ID, strings.Join(listing.Aliases, ", "), listing.Description, len(listing.Steps), strings.Join(args, " "), file)
+	}
+	writer.Flush() // nolint: gosec
+}
@@ -0,0 +1,221 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectMigrate is the command for upgrading a project configuration file to the current version
+type ProjectMigrate struct {
+	BaseCommand
+}
+
+// Commands returns the operations supported by this command
+func (cmd *ProjectMigrate) Commands() []cli.Command {
+	migrate := cli.Command{
+		Name:        "config:migrate",
+		Usage:       "Migrate the project configuration file to version 2.0.",
+		ArgsUsage:   "[optional path to config file]",
+		Description: "Rewrites a version 1.0 Outrigger project configuration as version 2.0, keeping comments in place. Script 'alias' becomes an 'aliases' list, 'run' becomes 'steps', and sync ignores become structured rules such as 'path: vendor/'.",
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Print the migrated configuration instead of writing it to the file.",
+			},
+		},
+		Before: cmd.Before,
+		Action: cmd.Run,
+	}
+
+	return []cli.Command{migrate}
+}
+
+// Run executes the `rig project config:migrate` command
+func (cmd *ProjectMigrate) Run(ctx *cli.Context) error {
+	file := ctx.Args().First()
+	if file == "" {
+		var err error
+		if file, err = ProjectConfigFilePath(); err != nil {
+			return cmd.Failure(err.Error(), "PROJECT-CONFIG-NOT-FOUND", 12)
+		}
+	}
+
+	// Only a valid configuration can be migrated mechanically.
+	config, err := NewProjectConfigFromFile(file)
+	if problems, invalid := err.(ConfigErrors); invalid {
+		for _, problem := range problems {
+			fmt.Fprintln(os.Stderr, problem)
+		}
+		return cmd.Failure(fmt.Sprintf("Project configuration %s must be valid before it can be migrated", file), "PROJECT-CONFIG-INVALID", 12)
+	} else if mismatch, ok := err.(*RigVersionError); ok {
+		return cmd.Failure(mismatch.Error(), "RIG-VERSION-UNSUPPORTED", 12)
+	} else if err != nil {
+		return cmd.Failure(fmt.Sprintf("Could not read project configuration %s: %s", file, err), "PROJECT-CONFIG-NOT-FOUND", 12)
+	}
+
+	for _, other := range config.Files {
+		if other != file {
+			cmd.out.Warning("Only %s is migrated, included or local file %s must be migrated separately", file, other)
+		}
+	}
+
+	if config.Version != "1.0" {
+		cmd.out.Info("Project configuration %s is already version %s", file, config.Version)
+		return cmd.Success("")
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return cmd.Failure(err.Error(), "PROJECT-CONFIG-NOT-FOUND", 12)
+	}
+	content, err := ioutil.ReadFile(file) // nolint: gosec
+	if err != nil {
+		return cmd.Failure(err.Error(), "PROJECT-CONFIG-NOT-FOUND", 12)
+	}
+
+	migrated, err := MigrateProjectConfig(content)
+	if err != nil {
+		return cmd.Failure(fmt.Sprintf("Could not migrate %s: %s", file, err), "PROJECT-CONFIG-MIGRATE-FAILED", 12)
+	}
+
+	if ctx.Bool("dry-run") {
+		fmt.Print(string(migrated))
+		return nil
+	}
+
+	if err := ioutil.WriteFile(file, migrated, info.Mode()); err != nil {
+		return cmd.Failure(fmt.Sprintf("Could not write %s: %s", file, err), "PROJECT-CONFIG-MIGRATE-FAILED", 12)
+	}
+
+	return cmd.Success(fmt.Sprintf("Project configuration %s migrated to version 2.0", file))
+}
+
+// MigrateProjectConfig converts the content of a version 1.0 project config
+// file to version 2.0. The YAML document is edited in place so comments and
+// key order survive the rewrite.
+func MigrateProjectConfig(content []byte) ([]byte, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, err
+	}
+	if len(document.Content) == 0 {
+		return nil, fmt.Errorf("configuration file is empty")
+	}
+	root := document.Content[0]
+
+	if version := mappingValue(root, "version"); version != nil {
+		version.Value = "2.0"
+	}
+
+	if scripts := mappingValue(root, "scripts"); scripts != nil {
+		for i := 1; i < len(scripts.Content); i += 2 {
+			migrateScript(resolveAlias(scripts.Content[i]))
+		}
+	}
+
+	if sync := mappingValue(root, "sync"); sync != nil {
+		if ignore := mappingValue(sync, "ignore"); ignore != nil {
+			for i, rule := range ignore.Content {
+				migrated, err := migrateIgnoreRule(rule)
+				if err != nil {
+					return nil, err
+				}
+				ignore.Content[i] = migrated
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&document); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+
+	return restoreBlankLines(content, out.Bytes()), nil
+}
+
+// restoreBlankLines re-inserts the blank lines the YAML encoder drops. Each
+// blank line of the original is placed before the next original line that
+// survived the migration unchanged.
+func restoreBlankLines(original, migrated []byte) []byte {
+	migratedLines := strings.Split(string(migrated), "\n")
+	lines := []string{}
+	next := 0
+	blank := false
+	for _, line := range strings.Split(string(original), "\n") {
+		if strings.TrimSpace(line) == "" {
+			blank = true
+			continue
+		}
+		for i := next; i < len(migratedLines); i++ {
+			if migratedLines[i] == line {
+				lines = append(lines, migratedLines[next:i]...)
+				if blank && len(lines) > 0 && lines[len(lines)-1] != "" {
+					lines = append(lines, "")
+				}
+				lines = append(lines, migratedLines[i])
+				next, blank = i+1, false
+				break
+			}
+		}
+	}
+	lines = append(lines, migratedLines[next:]...)
+
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// migrateScript renames the version 1.0 script keys to their 2.0 equivalents.
+func migrateScript(script *yaml.Node) {
+	for i := 0; i+1 < len(script.Content); i += 2 {
+		key, value := script.Content[i], script.Content[i+1]
+		switch key.Value {
+		case "alias":
+			key.Value = "aliases"
+			script.Content[i+1] = &yaml.Node{
+				Kind:        yaml.SequenceNode,
+				Tag:         "!!seq",
+				Style:       yaml.FlowStyle,
+				Content:     []*yaml.Node{{Kind: yaml.ScalarNode, Tag: "!!str", Value: value.Value, Style: value.Style}},
+				LineComment: value.LineComment,
+			}
+		case "run":
+			key.Value = "steps"
+		}
+	}
+}
+
+// migrateIgnoreRule converts a unison ignore string such as "Path vendor/" into
+// a structured rule such as `path: vendor/`.
+func migrateIgnoreRule(rule *yaml.Node) (*yaml.Node, error) {
+	parts := strings.SplitN(strings.TrimSpace(rule.Value), " ", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("line %d: cannot convert ignore rule '%s'", rule.Line, rule.Value)
+	}
+
+	for key, unisonType := range unisonIgnoreTypes {
+		if parts[0] == unisonType {
+			return &yaml.Node{
+				Kind:        yaml.MappingNode,
+				Tag:         "!!map",
+				HeadComment: rule.HeadComment,
+				FootComment: rule.FootComment,
+				Content: []*yaml.Node{
+					{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+					{Kind: yaml.ScalarNode, Tag: "!!str", Value: strings.TrimSpace(parts[1]), LineComment: rule.LineComment},
+				},
+			}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("line %d: unrecognized ignore type '%s' in rule '%s'", rule.Line, parts[0], rule.Value)
+}
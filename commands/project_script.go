@@ -1,12 +1,18 @@
 package commands
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
 
+	"github.com/fatih/color"
 	"github.com/phase2/rig/util"
 )
 
@@ -15,32 +21,529 @@ import (
 type ProjectScript struct {
 	out    *util.RigLogger
 	config *ProjectConfig
+	// calls lists the scripts whose steps called the one being run.
+	calls []string
+	// inherited is the environment of the calling script, if any.
+	inherited util.Environment
+	// output receives the output of steps instead of the terminal, for Capture.
+	output io.Writer
+}
+
+// ScriptFailure describes why a project script did not complete, in the
+// terms needed to report it via BaseCommand.Failure.
+type ScriptFailure struct {
+	Message   string
+	ErrorName string
+	ExitCode  int
+}
+
+// Error allows a ScriptFailure to be handled as an error.
+func (f *ScriptFailure) Error() string {
+	return f.Message
 }
 
 // Run takes a Script configuration and executes it per the definition of
-// the project script and bonus arguments from the extra parameter.
+// the project script, the values of its named arguments and bonus arguments
+// from the extra parameter.
+// Scripts it depends on are run first, each once and in dependency order and
+// with the defaults of their own arguments.
 // Commands are run from the directory context of the project if available.
+// Scripts and steps whose when conditions do not hold are skipped and steps
+// written as @id call another project script in the same rig process.
 // This also supports follow-up user interaction.
-func (p *ProjectScript) Run(script *Script, extra []string) int {
-	return util.PassthruCommand(p.prepareToExecute(script, extra))
+func (p *ProjectScript) Run(script *Script, values map[string]string, extra []string) *ScriptFailure {
+	order, err := p.config.ScriptExecutionOrder(script)
+	if err != nil {
+		return &ScriptFailure{err.Error(), "SCRIPT-DEPENDENCY-ERROR", 12}
+	}
+
+	if p.inherited == nil {
+		p.addCommandPath()
+	}
+
+	// Arguments and shells of every script are checked before any of them runs.
+	resolved := make([]map[string]string, len(order))
+	for i, current := range order {
+		var given map[string]string
+		if current == script {
+			given = values
+		}
+		if resolved[i], err = current.ArgValues(given); err != nil {
+			return &ScriptFailure{err.Error(), "SCRIPT-ARGS-INVALID", 12}
+		}
+		if failure := p.checkShell(current); failure != nil {
+			return failure
+		}
+	}
+
+	for i, current := range order {
+		if failure := p.checkRecursion(current); failure != nil {
+			return failure
+		}
+
+		var args []string
+		if current == script {
+			args = extra
+		} else {
+			p.out.Verbose("Running project script '%s' required by '%s'", current.ID, script.ID)
+		}
+
+		var failure *ScriptFailure
+		if env, err := p.environment(current); err != nil {
+			failure = &ScriptFailure{err.Error(), "SCRIPT-ENV-ERROR", 12}
+		} else if steps, skipped := p.activeSteps(current, env); skipped != "" && current == script {
+			p.out.Info("Skipping project script '%s', it %s", current.ID, skipped)
+		} else if skipped != "" {
+			p.out.Verbose("Skipping project script '%s', it %s", current.ID, skipped)
+		} else if len(steps) == 0 {
+			p.out.Verbose("Every step of project script '%s' was skipped", current.ID)
+		} else if current.Parallel {
+			failure = p.runParallel(current, env, steps, resolved[i], args)
+		} else {
+			failure = p.runSteps(current, env, steps, resolved[i], args)
+		}
+
+		if failure != nil {
+			if current != script {
+				failure.Message = fmt.Sprintf("%s required by '%s'", failure.Message, script.ID)
+			}
+			return failure
+		}
+	}
+
+	return nil
+}
+
+// stepResult carries the outcome of a step and how long it ran.
+type stepResult struct {
+	index   int
+	name    string
+	elapsed time.Duration
+	// failure is set when the step failed, even if it continues on error.
+	failure *ScriptFailure
+	// status summarizes the outcome: ok, failed, continued or stopped.
+	status string
+}
+
+// stepName names a step of a script, using step-N for unnamed steps.
+func stepName(script *Script, step *Step) string {
+	if step.Name != "" {
+		return step.Name
+	}
+	for i, candidate := range script.Steps {
+		if candidate == step {
+			return fmt.Sprintf("step-%d", i+1)
+		}
+	}
+
+	return "step"
+}
+
+// stepNames names each of the given steps of a script.
+func stepNames(script *Script, steps []*Step) []string {
+	names := make([]string, len(steps))
+	for i, step := range steps {
+		names[i] = stepName(script, step)
+	}
+
+	return names
+}
+
+// activeSteps evaluates the when conditions of a script and its steps against
+// the script environment, before any command is built. When the script itself
+// does not apply the reason is returned instead of its steps.
+func (p *ProjectScript) activeSteps(script *Script, env util.Environment) ([]*Step, string) {
+	dir := p.GetWorkingDirectory()
+	if reason := script.When.Unmet(env, dir); reason != "" {
+		return nil, reason
+	}
+
+	steps := []*Step{}
+	for _, step := range script.Steps {
+		if reason := step.When.Unmet(env, dir); reason != "" {
+			p.out.Verbose("Skipping step '%s' of script '%s', it %s", stepName(script, step), script.ID, reason)
+			continue
+		}
+		steps = append(steps, step)
+	}
+
+	return steps, ""
+}
+
+// runSteps runs the steps of a script one at a time, each in its own process
+// sharing the script environment, so the outcome and duration of every step
+// is known and its timeout, retries and continue_on_error policy can be
+// applied. Extra arguments are passed, quoted, to the last step.
+//
+// The status of a step whose output is captured is reported with a spinner.
+// Steps passing their output through to the terminal are announced by a line
+// of their own instead, which like the completion of each step is only shown
+// for scripts of several steps. Those end with a timing summary.
+func (p *ProjectScript) runSteps(script *Script, env util.Environment, steps []*Step, values map[string]string, extra []string) *ScriptFailure {
+	p.out.Verbose("Initializing project script '%s' with %d steps: %s", script.ID, len(steps), script.Description)
+
+	commands, failure := p.renderSteps(script, steps, values)
+	if failure != nil {
+		return failure
+	}
+
+	names := stepNames(script, steps)
+	results := []stepResult{}
+	for i, step := range steps {
+		var args []string
+		if i == len(steps)-1 {
+			args = extra
+		}
+
+		// Only steps without a timeout keep the terminal for input.
+		step, command := step, commands[i]
+		tty := p.output == nil && util.StdinIsTerminal() && step.Timeout == 0
+		create := func() (*exec.Cmd, *ScriptFailure) {
+			created, failure := p.scriptCommand(script, env, []string{command}, args, tty)
+			if failure == nil && p.output != nil {
+				created.Stdout = p.output
+				created.Stderr = os.Stderr
+			}
+			return created, failure
+		}
+		run := func(command *exec.Cmd) (int, error) {
+			if p.output != nil {
+				return util.RunCommandTimeout(command, step.Timeout, nil)
+			} else if step.Timeout > 0 {
+				return util.PassthruCommandTimeout(command, step.Timeout)
+			}
+			return util.PassthruCommand(command), nil
+		}
+
+		// A called script reports the status of its own steps.
+		id, _, called := ScriptReference(step.Run)
+		if called {
+			create, run = p.scriptCall(script, env, id, command, args)
+			p.out.Verbose("Running step '%s' of script '%s' by calling script '%s'", names[i], script.ID, id)
+		} else if p.output != nil {
+			p.out.SpinWithVerbose("Running step '%s' of script '%s'", names[i], script.ID)
+		} else if len(script.Steps) > 1 {
+			p.out.Info("Running step '%s' of script '%s'", names[i], script.ID)
+		} else {
+			p.out.Verbose("Running step '%s' of script '%s'", names[i], script.ID)
+		}
+		result := p.runStep(script, step, names[i], create, run)
+		result.index = i
+		results = append(results, result)
+
+		if result.status == "continued" {
+			p.out.Warning("%s, continuing", result.failure.Message)
+		} else if result.failure != nil {
+			p.out.Error("Step '%s' failed after %s", names[i], roundDuration(result.elapsed))
+			failure = result.failure
+			break
+		} else if !called && len(script.Steps) > 1 {
+			p.out.Info("Step '%s' completed in %s", names[i], roundDuration(result.elapsed))
+		} else if !called {
+			if p.out.Spinning {
+				p.out.NoSpin()
+			}
+			p.out.Verbose("Step '%s' completed in %s", names[i], roundDuration(result.elapsed))
+		}
+	}
+
+	p.printStepSummary(script, results)
+	return failure
+}
+
+// renderSteps replaces the argument placeholders in the steps of a script
+// before any of them runs. Values are written as literals of the shell of the
+// script or, for steps calling another script, quoted in the arguments of the
+// call, which are returned without the id of the called script.
+func (p *ProjectScript) renderSteps(script *Script, steps []*Step, values map[string]string) ([]string, *ScriptFailure) {
+	shell, err := p.config.ScriptShell(script)
+	if err != nil {
+		return nil, &ScriptFailure{fmt.Sprintf("Project script '%s' has an invalid shell: %s", script.ID, err), "SHELL-INVALID", 12}
+	}
+
+	commands := make([]string, len(steps))
+	for i, step := range steps {
+		if _, line, called := ScriptReference(step.Run); called {
+			commands[i] = RenderCall(line, values)
+		} else if commands[i], err = RenderStep(step.Run, values, shell); err != nil {
+			return nil, &ScriptFailure{fmt.Sprintf("Project script '%s' uses %s", script.ID, err), "SCRIPT-ARGS-INVALID", 12}
+		}
+	}
+
+	return commands, nil
+}
+
+// runStep runs a step until it succeeds or runs out of retries, waiting
+// retry_delay before the first retry and doubling the wait for each one after.
+// The failure of a step set to continue_on_error is reported with the status
+// continued. The create function makes the command for each attempt and run
+// executes it, returning a ScriptFailure as the error of a called script.
+func (p *ProjectScript) runStep(script *Script, step *Step, name string, create func() (*exec.Cmd, *ScriptFailure), run func(*exec.Cmd) (int, error)) (result stepResult) {
+	delay := step.RetryDelay
+	if delay == 0 {
+		delay = time.Second
+	}
+
+	result = stepResult{name: name, status: "ok"}
+	started := time.Now()
+	defer func() { result.elapsed = time.Since(started) }()
+
+	for attempt := 1; ; attempt++ {
+		command, failure := create()
+		if failure != nil {
+			result.failure, result.status = failure, "failed"
+			return result
+		}
+
+		exitCode, err := run(command)
+		call, isCall := err.(*ScriptFailure)
+		switch {
+		case isCall:
+			result.failure = &ScriptFailure{fmt.Sprintf("%s, called by step '%s' of project script '%s'", call.Message, name, script.ID), call.ErrorName, call.ExitCode}
+		case err == util.ErrCommandStopped:
+			result.status = "stopped"
+			return result
+		case err == util.ErrCommandInterrupted:
+			result.failure, result.status = &ScriptFailure{fmt.Sprintf("Step '%s' of project script '%s' was interrupted", name, script.ID), "COMMAND-INTERRUPTED", 130}, "failed"
+			return result
+		case err == util.ErrCommandTimeout:
+			result.failure = &ScriptFailure{fmt.Sprintf("Step '%s' of project script '%s' timed out after %s", name, script.ID, step.Timeout), "COMMAND-TIMEOUT", 124}
+		case err != nil:
+			result.failure = &ScriptFailure{fmt.Sprintf("Step '%s' of project script '%s' could not be started: %s", name, script.ID, err), "COMMAND-ERROR", exitCode}
+		case exitCode != 0:
+			result.failure = &ScriptFailure{fmt.Sprintf("Step '%s' of project script '%s' failed with exit code %d", name, script.ID, exitCode), "COMMAND-ERROR", exitCode}
+		default:
+			result.failure = nil
+			return result
+		}
+
+		if attempt > step.Retries {
+			break
+		}
+		p.out.Warning("%s, retrying in %s (attempt %d of %d)", result.failure.Message, delay, attempt+1, step.Retries+1)
+		time.Sleep(delay)
+		delay *= 2
+	}
+
+	if step.Retries > 0 {
+		result.failure.Message = fmt.Sprintf("%s after %d attempts", result.failure.Message, step.Retries+1)
+	}
+	result.status = "failed"
+	if step.ContinueOnError {
+		result.status = "continued"
+	}
+
+	return result
+}
+
+// runParallel starts every step of the script at the same time, prefixing each
+// line of output with the name of the step. By default the first failing step
+// stops the others; with wait_all set every step is allowed to finish. Extra
+// arguments are passed, quoted, to the last step.
+func (p *ProjectScript) runParallel(script *Script, env util.Environment, steps []*Step, values map[string]string, extra []string) *ScriptFailure {
+	p.out.Verbose("Initializing project script '%s' with %d parallel steps: %s", script.ID, len(steps), script.Description)
+
+	commands, failure := p.renderSteps(script, steps, values)
+	if failure != nil {
+		return failure
+	}
+
+	names := stepNames(script, steps)
+	width := 0
+	for _, name := range names {
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+
+	var lock sync.Mutex
+	colors := []color.Attribute{color.FgCyan, color.FgMagenta, color.FgGreen, color.FgYellow, color.FgBlue}
+	writers := []*util.PrefixWriter{}
+	stop := make(chan struct{})
+	results := make(chan stepResult, len(steps))
+	for i, step := range steps {
+		var args []string
+		if i == len(steps)-1 {
+			args = extra
+		}
+
+		prefix := color.New(colors[i%len(colors)]).Sprintf("%-*s | ", width, names[i])
+		stdout := util.NewPrefixWriter(p.stdout(), prefix, &lock)
+		stderr := util.NewPrefixWriter(os.Stderr, prefix, &lock)
+		writers = append(writers, stdout, stderr)
+
+		step, command := step, commands[i]
+		create := func() (*exec.Cmd, *ScriptFailure) {
+			created, failure := p.scriptCommand(script, env, []string{command}, args, false)
+			if failure == nil {
+				created.Stdout = stdout
+				created.Stderr = stderr
+			}
+			return created, failure
+		}
+		run := func(command *exec.Cmd) (int, error) {
+			return util.RunCommandTimeout(command, step.Timeout, stop)
+		}
+
+		p.out.Verbose("Starting step '%s' of script '%s'", names[i], script.ID)
+		go func(i int) {
+			result := p.runStep(script, step, names[i], create, run)
+			result.index = i
+			results <- result
+		}(i)
+	}
+
+	collected := make([]stepResult, len(steps))
+	for range steps {
+		result := <-results
+		collected[result.index] = result
+		if result.failure == nil || result.status == "continued" || failure != nil {
+			continue
+		}
+
+		failure = result.failure
+		if !script.WaitAll {
+			p.out.Verbose("Stopping remaining steps of script '%s'", script.ID)
+			close(stop)
+		}
+	}
+
+	for _, writer := range writers {
+		writer.Flush() // nolint: gosec
+	}
+	for _, result := range collected {
+		if result.status == "continued" {
+			p.out.Warning("%s, continuing", result.failure.Message)
+		}
+	}
+
+	p.printStepSummary(script, collected)
+	return failure
+}
+
+// printStepSummary lists how long each step of a script ran and its outcome.
+// Scripts of a single step are not summarized.
+func (p *ProjectScript) printStepSummary(script *Script, results []stepResult) {
+	if len(script.Steps) < 2 || len(results) == 0 {
+		return
+	}
+
+	var total time.Duration
+	for _, result := range results {
+		if script.Parallel {
+			if result.elapsed > total {
+				total = result.elapsed
+			}
+		} else {
+			total += result.elapsed
+		}
+	}
+	p.out.Info("Project script '%s' ran for %s", script.ID, roundDuration(total))
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, result := range results {
+		fmt.Fprintf(writer, "  %s\t%s\t%s\n", result.name, roundDuration(result.elapsed), result.status)
+	}
+	writer.Flush() // nolint: gosec
+}
+
+// roundDuration rounds a duration for display, to tenths of a second.
+func roundDuration(duration time.Duration) time.Duration {
+	return duration.Round(100 * time.Millisecond)
 }
 
 // Capture matches Run, but returns the data from the command
 // execution instead of "streaming" the result to the terminal.
+// Named arguments take their default values. Only the standard output of the
+// steps is returned; their errors are still written to the terminal.
 func (p *ProjectScript) Capture(script *Script, extra []string) (string, int, error) {
-	return util.CaptureCommand(p.prepareToExecute(script, extra))
+	var output bytes.Buffer
+	capture := *p
+	capture.output = &output
+	if failure := capture.Run(script, nil, extra); failure != nil {
+		return output.String(), failure.ExitCode, failure
+	}
+
+	return output.String(), 0, nil
 }
 
-// prepareToExecute is an internal method that handles standardized "preflight"
-// steps before executing the command, including logging.
-func (p *ProjectScript) prepareToExecute(script *Script, extra []string) *exec.Cmd {
-	p.out.Verbose("Initializing project script '%s': %s", script.ID, script.Description)
-	p.addCommandPath()
-	dir := p.GetWorkingDirectory()
-	shellCmd := p.CreateCommand(script.Run, extra, dir)
-	shellCmd.Env = append(os.Environ(), "RIG_POWER_USER_MODE=1")
-	p.out.Verbose("Evaluating Script '%s'", script.ID)
-	return shellCmd
+// stdout is where the output of steps is written, the terminal unless it is
+// captured.
+func (p *ProjectScript) stdout() io.Writer {
+	if p.output != nil {
+		return p.output
+	}
+
+	return os.Stdout
+}
+
+// scriptCommand assembles the command running steps of a script in its
+// directory and environment, on the host or in its service or container. The
+// tty parameter determines whether a terminal is allocated in a container.
+func (p *ProjectScript) scriptCommand(script *Script, env util.Environment, steps, extra []string, tty bool) (*exec.Cmd, *ScriptFailure) {
+	dir, failure := p.ScriptDirectory(script)
+	if failure != nil {
+		return nil, failure
+	}
+
+	shell, err := p.config.ScriptShell(script)
+	if err != nil {
+		return nil, &ScriptFailure{fmt.Sprintf("Project script '%s' has an invalid shell: %s", script.ID, err), "SHELL-INVALID", 12}
+	}
+
+	var command *exec.Cmd
+	if script.Service != "" || script.Container != "" {
+		if command, failure = p.CreateContainerCommand(script, shell, steps, extra, env, tty); failure != nil {
+			return nil, failure
+		}
+	} else {
+		command = p.CreateShellCommand(shell, steps, extra, dir)
+	}
+	command.Dir = dir
+	command.Env = env.List()
+
+	return command, nil
+}
+
+// environment assembles the variables for the commands of a script. The
+// project env_file and env settings are applied over the current environment,
+// followed by those of the script. A called script starts from the environment
+// of the script calling it instead, adding only its own settings. Env files
+// are found relative to the project root and values may use ${VAR:-default}
+// interpolation.
+func (p *ProjectScript) environment(script *Script) (util.Environment, error) {
+	env := util.NewEnvironment(os.Environ())
+	scopes := []struct {
+		files  []string
+		values map[string]string
+	}{
+		{p.config.EnvFile, p.config.Env},
+		{script.EnvFile, script.Env},
+	}
+	if p.inherited != nil {
+		env = util.Environment{}
+		for name, value := range p.inherited {
+			env[name] = value
+		}
+		scopes = scopes[1:]
+	}
+
+	for _, scope := range scopes {
+		for _, file := range scope.files {
+			file = env.Expand(file)
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(p.GetWorkingDirectory(), file)
+			}
+			p.out.Verbose("Loading environment file for script '%s': %s", script.ID, file)
+			if err := env.LoadFile(file); err != nil {
+				return nil, fmt.Errorf("Could not load environment file for project script '%s': %s", script.ID, err)
+			}
+		}
+		env.Merge(scope.values)
+	}
+	env["RIG_POWER_USER_MODE"] = "1"
+
+	return env, nil
 }
 
 // GetCommand is a deprecation wrapper around NormalizeCommand.
@@ -50,44 +553,84 @@ func (p *ProjectScript) GetCommand(steps, extra []string, workingDirectory strin
 }
 
 // CreateCommand is a factory method to assemble an executable command from
-// project-derived parameters.
+// project-derived parameters, run by the default shell of the platform.
 // @see https://github.com/medhoover/gom/blob/staging/config/command.go
 func (p *ProjectScript) CreateCommand(steps, extra []string, workingDirectory string) *exec.Cmd {
-	// Concat the commands together adding the args to this command as args to the last step
-	scriptCommands := strings.Join(steps, p.getCommandSeparator()) + " " + strings.Join(extra, " ")
+	return p.CreateShellCommand(DefaultShell(), steps, extra, workingDirectory)
+}
 
-	var command *exec.Cmd
-	if util.IsWindows() {
-		/* #nosec */
-		command = exec.Command("cmd", "/c", scriptCommands)
-	} else {
-		/* #nosec */
-		command = exec.Command("sh", "-c", scriptCommands)
+// CreateShellCommand assembles a command running the steps with the shell,
+// passing the extra arguments to the last step.
+func (p *ProjectScript) CreateShellCommand(shell *Shell, steps, extra []string, workingDirectory string) *exec.Cmd {
+	args := shell.Command(steps, extra)
+	/* #nosec */
+	command := exec.Command(args[0], args[1:]...)
+	if shell.CommandLine {
+		util.SetCommandLine(command, strings.Join(args, " "))
 	}
 	command.Dir = workingDirectory
 
 	return command
 }
 
+// checkShell makes sure the shell of a script run on the host can be found
+// before any of its steps run.
+func (p *ProjectScript) checkShell(script *Script) *ScriptFailure {
+	shell, err := p.config.ScriptShell(script)
+	if err != nil {
+		return &ScriptFailure{fmt.Sprintf("Project script '%s' has an invalid shell: %s", script.ID, err), "SHELL-INVALID", 12}
+	}
+	if script.Service != "" || script.Container != "" {
+		return nil
+	}
+
+	if _, err := exec.LookPath(shell.Argv[0]); err != nil {
+		return &ScriptFailure{fmt.Sprintf("Shell '%s' for project script '%s' was not found: %s", shell.Name, script.ID, err), "SHELL-NOT-FOUND", 12}
+	}
+
+	return nil
+}
+
 // GetWorkingDirectory retrieves the working directory for project commands.
 func (p *ProjectScript) GetWorkingDirectory() string {
 	return filepath.Dir(p.config.Path)
 }
 
-// getCommandSeparator returns the command separator based on platform.
-func (p *ProjectScript) getCommandSeparator() string {
-	if util.IsWindows() {
-		return " & "
+// ScriptDirectory retrieves the directory a script runs in. This is the
+// project directory unless the script sets 'dir', which is resolved relative
+// to the project directory and must exist.
+func (p *ProjectScript) ScriptDirectory(script *Script) (string, *ScriptFailure) {
+	dir := p.GetWorkingDirectory()
+	if script.Dir == "" {
+		return dir, nil
+	}
+
+	if filepath.IsAbs(script.Dir) {
+		dir = script.Dir
+	} else {
+		dir = filepath.Join(dir, script.Dir)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "", &ScriptFailure{fmt.Sprintf("Directory '%s' for project script '%s' does not exist", dir, script.ID), "SCRIPT-DIR-NOT-FOUND", 12}
 	}
+	p.out.Verbose("Running project script '%s' in %s", script.ID, dir)
 
-	return " && "
+	return dir, nil
 }
 
 // addCommandPath overrides the PATH environment variable for further shell executions.
-// This is used on POSIX systems for lookup of scripts.
+// This is used on POSIX systems for lookup of scripts. Relative paths are
+// resolved from the project directory so they hold for scripts with a 'dir'.
 func (p *ProjectScript) addCommandPath() {
 	binDir := p.config.Bin
 	if binDir != "" {
+		paths := filepath.SplitList(binDir)
+		for i, path := range paths {
+			if !filepath.IsAbs(path) {
+				paths[i] = filepath.Join(p.GetWorkingDirectory(), path)
+			}
+		}
+		binDir = strings.Join(paths, string(os.PathListSeparator))
 		p.out.Verbose("Adding project bin directory to $PATH: %s", binDir)
 		path := os.Getenv("PATH")
 		os.Setenv("PATH", fmt.Sprintf("%s%c%s", binDir, os.PathListSeparator, path)) // nolint: gosec
@@ -0,0 +1,96 @@
+package commands
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/phase2/rig/util"
+)
+
+// scriptCall makes the functions running a step which calls another project
+// script, for use with runStep. The script runs in this rig process, starting
+// from the environment of the calling script, rather than by shelling out to
+// `rig project`. The failure of the called script is returned as the error.
+func (p *ProjectScript) scriptCall(script *Script, env util.Environment, id, line string, extra []string) (func() (*exec.Cmd, *ScriptFailure), func(*exec.Cmd) (int, error)) {
+	var nested *ProjectScript
+	var target *Script
+	var values map[string]string
+	var args []string
+	create := func() (*exec.Cmd, *ScriptFailure) {
+		var failure *ScriptFailure
+		nested, target, values, args, failure = p.prepareCall(script, env, id, line, extra)
+		return nil, failure
+	}
+	run := func(*exec.Cmd) (int, error) {
+		if failure := nested.Run(target, values, args); failure != nil {
+			return failure.ExitCode, failure
+		}
+		return 0, nil
+	}
+
+	return create, run
+}
+
+// prepareCall resolves the script called by a step and splits the arguments
+// of the call into the values of its named arguments, given as --name=value or
+// --name value, and extra arguments for its last step.
+func (p *ProjectScript) prepareCall(script *Script, env util.Environment, id, line string, extra []string) (*ProjectScript, *Script, map[string]string, []string, *ScriptFailure) {
+	target := p.config.Scripts[id]
+	if target == nil {
+		return nil, nil, nil, nil, &ScriptFailure{fmt.Sprintf("Project script '%s' calls unknown script '%s'", script.ID, id), "SCRIPT-NOT-FOUND", 12}
+	}
+
+	words, err := util.SplitShellArgs(line)
+	if err != nil {
+		return nil, nil, nil, nil, &ScriptFailure{fmt.Sprintf("Project script '%s' calls '%s' with invalid arguments: %s", script.ID, id, err), "SCRIPT-ARGS-INVALID", 12}
+	}
+
+	declared := map[string]bool{}
+	for _, arg := range target.Args {
+		declared[arg.Name] = true
+	}
+	values := map[string]string{}
+	args := []string{}
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+		if !strings.HasPrefix(word, "--") {
+			args = append(args, word)
+			continue
+		}
+
+		name, value, given := strings.TrimPrefix(word, "--"), "", false
+		if equals := strings.Index(name, "="); equals >= 0 {
+			name, value, given = name[:equals], name[equals+1:], true
+		}
+		if !declared[name] {
+			args = append(args, word)
+			continue
+		}
+		if !given && i+1 < len(words) {
+			i++
+			value = words[i]
+		}
+		values[name] = value
+	}
+
+	nested := &ProjectScript{
+		out:       p.out,
+		config:    p.config,
+		calls:     append(p.calls[:len(p.calls):len(p.calls)], script.ID),
+		inherited: env,
+		output:    p.output,
+	}
+
+	return nested, target, values, append(args, extra...), nil
+}
+
+// checkRecursion fails when a script is run by a step it called itself, directly
+// or through other scripts.
+func (p *ProjectScript) checkRecursion(script *Script) *ScriptFailure {
+	if _, found := util.IndexOfString(p.calls, script.ID); !found {
+		return nil
+	}
+
+	return &ScriptFailure{fmt.Sprintf("Project script '%s' calls itself: %s -> %s", script.ID, strings.Join(p.calls, " -> "), script.ID), "SCRIPT-RECURSION", 12}
+}
@@ -0,0 +1,76 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+
+	"github.com/phase2/rig/util"
+)
+
+// CreateContainerCommand assembles a command running the steps of a script in
+// its docker-compose service or docker container. Steps are run by the shell
+// of the script within the container, sh by default, so scripts behave the
+// same on every host platform.
+//
+// A compose service that is up is used with `docker-compose exec`, otherwise
+// a one-off container is started with `docker-compose run`. A container must
+// already be running. Variables set by env and env_file are passed into the
+// container.
+func (p *ProjectScript) CreateContainerCommand(script *Script, shell *Shell, steps, extra []string, env util.Environment, tty bool) (*exec.Cmd, *ScriptFailure) {
+	var args []string
+	if script.Container != "" {
+		if !util.ContainerRunning(script.Container) {
+			return nil, &ScriptFailure{fmt.Sprintf("Container '%s' for project script '%s' is not running", script.Container, script.ID), "CONTAINER-NOT-RUNNING", 12}
+		}
+		args = []string{"docker", "exec", "-i"}
+		if tty {
+			args = append(args, "-t")
+		}
+	} else {
+		dir, failure := p.ScriptDirectory(script)
+		if failure != nil {
+			return nil, failure
+		}
+		if util.ComposeServiceRunning(script.Service, dir, env.List()) {
+			p.out.Verbose("Service '%s' is up, executing project script '%s' in it", script.Service, script.ID)
+			args = []string{"docker-compose", "exec"}
+		} else {
+			p.out.Verbose("Service '%s' is not up, starting a container for project script '%s'", script.Service, script.ID)
+			args = []string{"docker-compose", "run", "--rm"}
+		}
+		if !tty {
+			args = append(args, "-T")
+		}
+	}
+
+	for _, name := range p.declaredVariables(env) {
+		args = append(args, "-e", name+"="+env[name])
+	}
+
+	target := script.Container
+	if target == "" {
+		target = script.Service
+	}
+	args = append(args, target)
+	args = append(args, shell.Command(steps, extra)...)
+
+	/* #nosec */
+	return exec.Command(args[0], args[1:]...), nil
+}
+
+// declaredVariables lists the variables of a script environment that were set
+// or changed by the project configuration rather than inherited from rig.
+func (p *ProjectScript) declaredVariables(env util.Environment) []string {
+	inherited := util.NewEnvironment(os.Environ())
+	names := []string{}
+	for name, value := range env {
+		if current, ok := inherited[name]; !ok || current != value {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,194 @@
+package commands
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phase2/rig/util"
+)
+
+// newTestProjectScript loads an outrigger.yml with the content from a
+// temporary project directory for running its scripts.
+func newTestProjectScript(t *testing.T, content string) (*ProjectScript, func()) {
+	dir, cleanup := newTestProject(t, content)
+	config, err := NewProjectConfigFromFile(filepath.Join(dir, "outrigger.yml"))
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+
+	return &ProjectScript{out: util.Logger(), config: config}, cleanup
+}
+
+func TestCaptureRunsLikeRun(t *testing.T) {
+	scripts, cleanup := newTestProjectScript(t, `version: 2.0
+shell: sh
+scripts:
+  setup:
+    steps: [echo setup]
+  greet:
+    args:
+      - name: who
+        default: world
+    steps:
+      - run: echo hello {{ who }}
+      - run: echo skipped
+        when:
+          env: RIG_TEST_UNSET
+      - run: exit 3
+        continue_on_error: true
+      - "@shout --who=rig"
+  shout:
+    depends: [setup]
+    args:
+      - name: who
+    steps: ["echo HEY {{ who }}"]
+`)
+	defer cleanup()
+
+	output, exitCode, err := scripts.Capture(scripts.config.Scripts["greet"], []string{"again"})
+	if err != nil || exitCode != 0 {
+		t.Fatalf("expected greet to succeed, found %d: %v", exitCode, err)
+	}
+	if expected := "hello world\nsetup\nHEY rig again\n"; output != expected {
+		t.Errorf("expected output %q, found %q", expected, output)
+	}
+	if scripts.output != nil {
+		t.Error("expected Capture to leave the output of the script alone")
+	}
+
+	scripts.config.Scripts["shout"].Steps[0].Run = "echo partial; exit 4"
+	output, exitCode, err = scripts.Capture(scripts.config.Scripts["greet"], nil)
+	if err == nil || exitCode != 4 || output != "hello world\nsetup\npartial\n" {
+		t.Errorf("expected the failing call to exit with 4 after its output, found %d %q: %v", exitCode, output, err)
+	}
+}
+
+func TestParallelStepsFailFast(t *testing.T) {
+	scripts, cleanup := newTestProjectScript(t, `version: 2.0
+shell: sh
+scripts:
+  fast:
+    parallel: true
+    steps:
+      - name: slow
+        run: sleep 5; echo slow done
+      - name: broken
+        run: echo broken; exit 3
+  all:
+    parallel: true
+    wait_all: true
+    steps:
+      - name: slow
+        run: sleep 0.5; echo slow done
+      - name: broken
+        run: exit 3
+`)
+	defer cleanup()
+
+	started := time.Now()
+	output, exitCode, err := scripts.Capture(scripts.config.Scripts["fast"], nil)
+	if elapsed := time.Since(started); elapsed > 3*time.Second {
+		t.Errorf("expected the failing step to stop the others, ran for %s", elapsed)
+	}
+	if err == nil || exitCode != 3 || !strings.Contains(output, "broken") || strings.Contains(output, "slow done") {
+		t.Errorf("expected the script to fail with 3 before the slow step finished, found %d %q: %v", exitCode, output, err)
+	}
+
+	started = time.Now()
+	output, exitCode, err = scripts.Capture(scripts.config.Scripts["all"], nil)
+	if elapsed := time.Since(started); elapsed < 500*time.Millisecond {
+		t.Errorf("expected wait_all to wait for the slow step, ran for %s", elapsed)
+	}
+	if err == nil || exitCode != 3 || !strings.Contains(output, "slow done") {
+		t.Errorf("expected the slow step to finish and the script to fail with 3, found %d %q: %v", exitCode, output, err)
+	}
+}
+
+func TestStepPolicies(t *testing.T) {
+	scripts, cleanup := newTestProjectScript(t, `version: 2.0
+shell: sh
+scripts:
+  timeout:
+    steps:
+      - run: echo started; sleep 5; echo finished
+        timeout: 200ms
+  retry:
+    steps:
+      - run: echo attempt; exit 2
+        retries: 2
+        retry_delay: 100ms
+  continue:
+    steps:
+      - run: echo first; exit 5
+        continue_on_error: true
+      - echo second
+`)
+	defer cleanup()
+
+	started := time.Now()
+	output, exitCode, err := scripts.Capture(scripts.config.Scripts["timeout"], nil)
+	if elapsed := time.Since(started); elapsed > 3*time.Second {
+		t.Errorf("expected the step to be stopped after its timeout, ran for %s", elapsed)
+	}
+	if err == nil || exitCode != 124 || output != "started\n" {
+		t.Errorf("expected the step to time out with 124, found %d %q: %v", exitCode, output, err)
+	}
+
+	// Attempts wait 100ms then 200ms.
+	started = time.Now()
+	output, exitCode, err = scripts.Capture(scripts.config.Scripts["retry"], nil)
+	if elapsed := time.Since(started); elapsed < 300*time.Millisecond || elapsed > 3*time.Second {
+		t.Errorf("expected the retries to back off for 300ms, ran for %s", elapsed)
+	}
+	if err == nil || exitCode != 2 || output != "attempt\nattempt\nattempt\n" || !strings.Contains(err.Error(), "after 3 attempts") {
+		t.Errorf("expected the step to fail with 2 after 3 attempts, found %d %q: %v", exitCode, output, err)
+	}
+
+	output, exitCode, err = scripts.Capture(scripts.config.Scripts["continue"], nil)
+	if err != nil || exitCode != 0 || output != "first\nsecond\n" {
+		t.Errorf("expected the script to continue past the failing step, found %d %q: %v", exitCode, output, err)
+	}
+}
+
+func TestScriptCalls(t *testing.T) {
+	scripts, cleanup := newTestProjectScript(t, `version: 2.0
+shell: sh
+env:
+  GREETING: hello
+scripts:
+  deploy:
+    env:
+      TARGET: staging
+    steps:
+      - "@notify --channel ops --level=warn 'two words' --other"
+  notify:
+    args:
+      - name: channel
+      - name: level
+        default: info
+    steps:
+      - run: echo "$GREETING $TARGET {{ channel }} {{ level }}"
+      - run: printf '[%s]\n'
+  ping:
+    steps: ["@pong"]
+  pong:
+    steps: ["@ping"]
+`)
+	defer cleanup()
+
+	// Named arguments fill in the placeholders and the rest, along with the
+	// extra arguments, are passed to the last step of the called script,
+	// which starts from the environment of the caller.
+	output, exitCode, err := scripts.Capture(scripts.config.Scripts["deploy"], []string{"extra"})
+	if expected := "hello staging ops warn\n[two words]\n[--other]\n[extra]\n"; err != nil || exitCode != 0 || output != expected {
+		t.Errorf("expected output %q, found %d %q: %v", expected, exitCode, output, err)
+	}
+
+	failure := scripts.Run(scripts.config.Scripts["ping"], nil, nil)
+	if failure == nil || failure.ErrorName != "SCRIPT-RECURSION" || failure.ExitCode != 12 || !strings.Contains(failure.Message, "ping -> pong -> ping") {
+		t.Errorf("expected the recursive call to be refused, found %v", failure)
+	}
+}
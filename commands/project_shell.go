@@ -0,0 +1,116 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/phase2/rig/util"
+)
+
+// shellCommandPlaceholder stands in for the step in the arguments of a shell.
+const shellCommandPlaceholder = "{command}"
+
+// Shell is an interpreter for the steps of project scripts.
+type Shell struct {
+	// Name identifies the shell in messages.
+	Name string
+	// Argv is the command line running a step, with {command} standing in for
+	// the step.
+	Argv []string
+	// Separator joins steps run by a single command.
+	Separator string
+	// Quote quotes extra arguments appended to the step. Shells without it,
+	// such as python, receive extra arguments after Argv instead.
+	Quote func(string) string
+	// Literal writes a value as a literal of the language of the shell, for
+	// {{ name }} argument placeholders in steps. Shells without it, such as
+	// custom shells, can not use placeholders.
+	Literal func(string) string
+	// CommandLine passes Argv joined by spaces to the shell as written on
+	// Windows, for cmd which does not split its command line like other
+	// programs.
+	CommandLine bool
+}
+
+// shells are the interpreters which may be selected by name with the shell
+// setting.
+var shells = map[string]*Shell{
+	"sh":     {"sh", []string{"sh", "-c", shellCommandPlaceholder}, " && ", util.QuotePosixShellArg, util.QuotePosixShellArg, false},
+	"bash":   {"bash", []string{"bash", "-c", shellCommandPlaceholder}, " && ", util.QuotePosixShellArg, util.QuotePosixShellArg, false},
+	"zsh":    {"zsh", []string{"zsh", "-c", shellCommandPlaceholder}, " && ", util.QuotePosixShellArg, util.QuotePosixShellArg, false},
+	"pwsh":   {"pwsh", []string{"pwsh", "-NoProfile", "-Command", shellCommandPlaceholder}, "; ", quotePowerShellArg, quotePowerShellArg, false},
+	"cmd":    {"cmd", []string{"cmd", "/s", "/c", `"` + shellCommandPlaceholder + `"`}, " & ", util.QuoteWindowsShellArg, util.QuoteWindowsShellArg, true},
+	"python": {"python", []string{"python3", "-c", shellCommandPlaceholder}, "\n", nil, strconv.Quote, false},
+}
+
+// ShellNames lists the shells which may be selected by name.
+func ShellNames() []string {
+	return []string{"sh", "bash", "zsh", "pwsh", "cmd", "python"}
+}
+
+// DefaultShell is the shell running steps on the host without a shell setting:
+// sh, or cmd on Windows.
+func DefaultShell() *Shell {
+	if util.IsWindows() {
+		return shells["cmd"]
+	}
+
+	return shells["sh"]
+}
+
+// NewShell resolves a shell setting, either the name of a shell or a custom
+// command line including {command}, such as [node, -e, "{command}"].
+func NewShell(setting []string) (*Shell, error) {
+	if len(setting) == 1 {
+		if shell, ok := shells[setting[0]]; ok {
+			return shell, nil
+		}
+		return nil, fmt.Errorf("unknown shell '%s', expected one of %s or a list of arguments including %s", setting[0], strings.Join(ShellNames(), ", "), shellCommandPlaceholder)
+	}
+
+	for _, arg := range setting {
+		if strings.Contains(arg, shellCommandPlaceholder) {
+			return &Shell{Name: setting[0], Argv: setting, Separator: "\n"}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("shell %v must include %s in its arguments", setting, shellCommandPlaceholder)
+}
+
+// Command assembles the command line running the steps, joined together, with
+// the extra arguments.
+func (s *Shell) Command(steps, extra []string) []string {
+	command := strings.Join(steps, s.Separator)
+	if s.Quote != nil {
+		for _, arg := range extra {
+			command += " " + s.Quote(arg)
+		}
+	}
+
+	args := make([]string, len(s.Argv))
+	for i, arg := range s.Argv {
+		args[i] = strings.Replace(arg, shellCommandPlaceholder, command, -1)
+	}
+	if s.Quote == nil {
+		args = append(args, extra...)
+	}
+
+	return args
+}
+
+// powerShellQuotes escapes every character PowerShell accepts as a single
+// quote, including the typographic ones, by doubling it.
+var powerShellQuotes = strings.NewReplacer(
+	"'", "''",
+	"\u2018", "\u2018\u2018",
+	"\u2019", "\u2019\u2019",
+	"\u201a", "\u201a\u201a",
+	"\u201b", "\u201b\u201b",
+)
+
+// quotePowerShellArg quotes a value so it is passed as a single argument by
+// PowerShell.
+func quotePowerShellArg(value string) string {
+	return "'" + powerShellQuotes.Replace(value) + "'"
+}
@@ -1,15 +1,16 @@
 package commands
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
-	"runtime"
+	"sort"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/urfave/cli"
@@ -24,9 +25,10 @@ type ProjectSync struct {
 	Config *ProjectConfig
 }
 
-// ComposeFile is a minimal compose file struct to discover volumes
+// ComposeFile is a minimal compose file struct to discover services and volumes
 type ComposeFile struct {
-	Volumes map[string]Volume
+	Services map[string]interface{}
+	Volumes  map[string]Volume
 }
 
 // Volume is a minimal volume spec to determine if a defined volume is declared external
@@ -43,13 +45,13 @@ func (cmd *ProjectSync) Commands() []cli.Command {
 		Name:        "sync:start",
 		Aliases:     []string{"sync"},
 		Category:    "File Sync",
-		Usage:       "Start a Unison sync on local project directory.",
-		Description: "Volume name will be discovered in the following order: outrigger project config > docker-compose file > current directory name",
+		Usage:       "Start a file sync of the local project directory.",
+		Description: "Volume name will be discovered in the following order: outrigger project config > docker-compose file > current directory name\n\n\tThe sync driver is chosen by the 'driver' sync setting of the project configuration: unison syncs both ways through a container, bind mounts the directory as the volume, copy copies the directory into the volume once and rsync-watch keeps copying changes into the volume from a container running rsync every second, or at the 'interval' sync setting. Only bind does not apply the ignore rules. Without it bind is used on Linux and unison elsewhere.\n\n\tThe local unison process runs in the background under a supervisor which restarts it should it exit, recording its state in the rig state directory for sync:status, sync:stop and sync:purge.",
 		Flags: []cli.Flag{
 			cli.IntFlag{
 				Name:   "initial-sync-timeout",
 				Value:  120,
-				Usage:  "Maximum amount of time in seconds to allow for detecting each of start of the Unison container and start of initial sync. If you encounter failures detecting initial sync increasing this value may help. Search for sync on http://docs.outrigger.sh/faq/troubleshooting/ (not needed on linux)",
+				Usage:  "Maximum amount of time in seconds to allow for detecting each of start of the Unison container and start of initial sync. If you encounter failures detecting initial sync increasing this value may help. Search for sync on http://docs.outrigger.sh/faq/troubleshooting/ (unison and rsync-watch drivers)",
 				EnvVar: "RIG_PROJECT_SYNC_TIMEOUT",
 			},
 			// Arbitrary sleep length but anything less than 3 wasn't catching
@@ -57,7 +59,7 @@ func (cmd *ProjectSync) Commands() []cli.Command {
 			cli.IntFlag{
 				Name:   "initial-sync-wait",
 				Value:  5,
-				Usage:  "Time in seconds to wait between checks to see if initial sync has finished. (not needed on linux)",
+				Usage:  "Time in seconds to wait between checks to see if initial sync has finished. (unison driver only)",
 				EnvVar: "RIG_PROJECT_INITIAL_SYNC_WAIT",
 			},
 			// Override the local sync path.
@@ -66,6 +68,12 @@ func (cmd *ProjectSync) Commands() []cli.Command {
 				Value: "",
 				Usage: "Specify the location in the local filesystem to be synced. If not used it will look for the directory of project configuration or fall back to current working directory. Use '--dir=.' to guarantee current working directory is used.",
 			},
+			// Choose one of several sync mappings.
+			cli.StringFlag{
+				Name:  "volume",
+				Value: "",
+				Usage: "Only operate on the sync mapping for this volume, rather than every mapping of the project configuration.",
+			},
 		},
 		Before: cmd.Before,
 		Action: cmd.RunStart,
@@ -73,7 +81,7 @@ func (cmd *ProjectSync) Commands() []cli.Command {
 	stop := cli.Command{
 		Name:        "sync:stop",
 		Category:    "File Sync",
-		Usage:       "Stops a Unison sync on local project directory.",
+		Usage:       "Stops the file sync of the local project directory.",
 		Description: "Volume name will be discovered in the following order: outrigger project config > docker-compose file > current directory name",
 		Flags: []cli.Flag{
 			// Override the local sync path.
@@ -82,6 +90,12 @@ func (cmd *ProjectSync) Commands() []cli.Command {
 				Value: "",
 				Usage: "Specify the location in the local filesystem to be synced. If not used it will look for the directory of project configuration or fall back to current working directory. Use '--dir=.' to guarantee current working directory is used.",
 			},
+			// Choose one of several sync mappings.
+			cli.StringFlag{
+				Name:  "volume",
+				Value: "",
+				Usage: "Only operate on the sync mapping for this volume, rather than every mapping of the project configuration.",
+			},
 		},
 		Before: cmd.Before,
 		Action: cmd.RunStop,
@@ -89,7 +103,7 @@ func (cmd *ProjectSync) Commands() []cli.Command {
 	name := cli.Command{
 		Name:        "sync:name",
 		Category:    "File Sync",
-		Usage:       "Retrieves the name used for the Unison volume and container.",
+		Usage:       "Retrieves the name used for the sync volume and container.",
 		Description: "This will perform the same name discovery used by sync:start and returns it to ease scripting.",
 		Flags: []cli.Flag{
 			// Override the local sync path.
@@ -98,6 +112,12 @@ func (cmd *ProjectSync) Commands() []cli.Command {
 				Value: "",
 				Usage: "Specify the location in the local filesystem to be synced. If not used it will look for the directory of project configuration or fall back to current working directory. Use '--dir=.' to guarantee current working directory is used.",
 			},
+			// Choose one of several sync mappings.
+			cli.StringFlag{
+				Name:  "volume",
+				Value: "",
+				Usage: "Only operate on the sync mapping for this volume, rather than every mapping of the project configuration.",
+			},
 		},
 		Before: cmd.Before,
 		Action: cmd.RunName,
@@ -105,13 +125,13 @@ func (cmd *ProjectSync) Commands() []cli.Command {
 	check := cli.Command{
 		Name:        "sync:check",
 		Category:    "File Sync",
-		Usage:       "Run doctor checks on the state of your unison file sync.",
+		Usage:       "Run doctor checks on the state of your file sync.",
 		Description: "This is intended to facilitate easy verification whether the filesync is down.",
 		Flags: []cli.Flag{
 			cli.IntFlag{
 				Name:   "initial-sync-timeout",
 				Value:  120,
-				Usage:  "Maximum amount of time in seconds to allow for detecting each of start of the Unison container and start of initial sync. If you encounter failures detecting initial sync increasing this value may help. Search for sync on http://docs.outrigger.sh/faq/troubleshooting/ (not needed on linux)",
+				Usage:  "Maximum amount of time in seconds to allow for detecting each of start of the Unison container and start of initial sync. If you encounter failures detecting initial sync increasing this value may help. Search for sync on http://docs.outrigger.sh/faq/troubleshooting/ (unison and rsync-watch drivers)",
 				EnvVar: "RIG_PROJECT_SYNC_TIMEOUT",
 			},
 			// Arbitrary sleep length but anything less than 3 wasn't catching
@@ -119,7 +139,7 @@ func (cmd *ProjectSync) Commands() []cli.Command {
 			cli.IntFlag{
 				Name:   "initial-sync-wait",
 				Value:  5,
-				Usage:  "Time in seconds to wait between checks to see if initial sync has finished. (not needed on linux)",
+				Usage:  "Time in seconds to wait between checks to see if initial sync has finished. (unison driver only)",
 				EnvVar: "RIG_PROJECT_INITIAL_SYNC_WAIT",
 			},
 			// Override the local sync path.
@@ -128,6 +148,12 @@ func (cmd *ProjectSync) Commands() []cli.Command {
 				Value: "",
 				Usage: "Specify the location in the local filesystem to be synced. If not used it will look for the directory of project configuration or fall back to current working directory. Use '--dir=.' to guarantee current working directory is used.",
 			},
+			// Choose one of several sync mappings.
+			cli.StringFlag{
+				Name:  "volume",
+				Value: "",
+				Usage: "Only operate on the sync mapping for this volume, rather than every mapping of the project configuration.",
+			},
 		},
 		Before: cmd.Before,
 		Action: cmd.RunCheck,
@@ -144,87 +170,78 @@ func (cmd *ProjectSync) Commands() []cli.Command {
 				Value: "",
 				Usage: "Specify the location in the local filesystem to be synced. If not used it will look for the directory of project configuration or fall back to current working directory. Use '--dir=.' to guarantee current working directory is used.",
 			},
+			// Choose one of several sync mappings.
+			cli.StringFlag{
+				Name:  "volume",
+				Value: "",
+				Usage: "Only operate on the sync mapping for this volume, rather than every mapping of the project configuration.",
+			},
 		},
 		Before: cmd.Before,
 		Action: cmd.RunPurge,
 	}
-	return []cli.Command{start, stop, name, check, purge}
+	status := cli.Command{
+		Name:        "sync:status",
+		Category:    "File Sync",
+		Usage:       "Report on the state of the file sync.",
+		Description: "Shows whether the sync volume exists and, for unison, whether the sync container and local unison process are running. The unison log is summarized with the time of the last successful sync, the number of items propagated, conflicts unison skipped and recent errors.",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "format",
+				Value: "table",
+				Usage: "Output format: table or json.",
+			},
+			// Override the local sync path.
+			cli.StringFlag{
+				Name:  "dir",
+				Value: "",
+				Usage: "Specify the location in the local filesystem to be synced. If not used it will look for the directory of project configuration or fall back to current working directory. Use '--dir=.' to guarantee current working directory is used.",
+			},
+			// Choose one of several sync mappings.
+			cli.StringFlag{
+				Name:  "volume",
+				Value: "",
+				Usage: "Only operate on the sync mapping for this volume, rather than every mapping of the project configuration.",
+			},
+		},
+		Before: cmd.Before,
+		Action: cmd.RunStatus,
+	}
+	return []cli.Command{start, stop, name, check, status, cmd.ignoresCommand(), purge, cmd.superviseCommand()}
 }
 
-// RunStart executes the `rig project sync:start` command to start the Unison sync process.
+// RunStart executes the `rig project sync:start` command to start the file sync.
 func (cmd *ProjectSync) RunStart(ctx *cli.Context) error {
-	volumeName, workingDir, err := cmd.initializeSettings(ctx.String("dir"))
-	if err != nil {
-		return cmd.Failure(err.Error(), "SYNC-PATH-ERROR", 12)
-	}
-
-	switch platform := runtime.GOOS; platform {
-	case "linux":
-		cmd.out.Verbose("Setting up local volume: %s", volumeName)
-		return cmd.SetupBindVolume(volumeName, workingDir)
-	default:
-		cmd.out.Verbose("Starting sync with volume: %s", volumeName)
-		return cmd.StartUnisonSync(ctx, volumeName, cmd.Config, workingDir)
-	}
+	return cmd.WithProjectHooks("sync:start", func() error {
+		return cmd.withSyncDriver(ctx, "Starting sync with volume", SyncDriver.Start)
+	})
 }
 
-// RunStop executes the `rig project sync:stop` command to shut down and unison containers
+// RunStop executes the `rig project sync:stop` command to shut down the file sync.
 func (cmd *ProjectSync) RunStop(ctx *cli.Context) error {
-	if util.IsLinux() {
-		return cmd.Success("No Unison container to stop, using local bind volume")
-	}
-	cmd.out.Spin(fmt.Sprintf("Stopping Unison container"))
-
-	volumeName, _, err := cmd.initializeSettings(ctx.String("dir"))
-	if err != nil {
-		return cmd.Failure(err.Error(), "SYNC-PATH-ERROR", 12)
-	}
-
-	cmd.out.Spin(fmt.Sprintf("Stopping Unison container (%s)", volumeName))
-	if err := util.Command("docker", "container", "stop", volumeName).Run(); err != nil {
-		return cmd.Failure(err.Error(), "SYNC-CONTAINER-FAILURE", 13)
-	}
-
-	return cmd.Success(fmt.Sprintf("Unison container '%s' stopped", volumeName))
+	return cmd.WithProjectHooks("sync:stop", func() error {
+		return cmd.withSyncDriver(ctx, "Stopping sync with volume", SyncDriver.Stop)
+	})
 }
 
 // RunName provides the name of the sync volume and container. This is made available to facilitate scripting.
 func (cmd *ProjectSync) RunName(ctx *cli.Context) error {
-	name, _, err := cmd.initializeSettings(ctx.String("dir"))
+	targets, err := cmd.syncTargets(ctx)
 	if err != nil {
-		return cmd.Failure(err.Error(), "SYNC-PATH-ERROR", 12)
+		return err
 	}
 
-	fmt.Println(name)
+	for _, target := range targets {
+		fmt.Println(target.Volume)
+	}
 	return nil
 }
 
 // RunCheck performs a doctor-like examination of the file sync health.
 func (cmd *ProjectSync) RunCheck(ctx *cli.Context) error {
-	cmd.out.Spin("Preparing test of unison filesync...")
-	volumeName, workingDir, err := cmd.initializeSettings(ctx.String("dir"))
-	if err != nil {
-		return cmd.Failure(err.Error(), "SYNC-PATH-ERROR", 12)
-	}
-	cmd.out.Info("Ready to begin unison test")
-	cmd.out.Spin("Checking for unison container...")
-	if running := util.ContainerRunning(volumeName); !running {
-		return cmd.Failure(fmt.Sprintf("Unison container (%s) is not running", volumeName), "SYNC-CHECK-FAILED", 13)
-	}
-	cmd.out.Info("Unison container found: %s", volumeName)
-	cmd.out.Spin("Check unison container process is listening...")
-	if _, err := cmd.WaitForUnisonContainer(volumeName, ctx.Int("initial-sync-timeout")); err != nil {
-		cmd.out.Error("Unison process not listening")
-		return cmd.Failure(err.Error(), "SYNC-CHECK-FAILED", 13)
-	}
-	cmd.out.Info("Unison process is listening")
-
-	// Determine if sync progress can be tracked.
-	//cmd.out.Spin("Syncing a test file...")
-	cmd.out.Info("Preparing live file sync test")
-	var logFile = cmd.LogFileName(volumeName)
-	if err := cmd.WaitForSyncInit(logFile, workingDir, ctx.Int("initial-sync-timeout"), ctx.Int("initial-sync-wait")); err != nil {
-		return cmd.Failure(err.Error(), "UNISON-SYNC-FAILED", 13)
+	cmd.out.Spin("Preparing test of file sync...")
+	if err := cmd.withSyncDriver(ctx, "Checking sync with volume", SyncDriver.Check); err != nil {
+		return err
 	}
 
 	// Sidestepping the notification so rig sync:check can be run as a background process.
@@ -234,180 +251,185 @@ func (cmd *ProjectSync) RunCheck(ctx *cli.Context) error {
 
 // RunPurge cleans out the project sync state.
 func (cmd *ProjectSync) RunPurge(ctx *cli.Context) error {
-	if util.IsLinux() {
-		return cmd.Success("No Unison process to clean up.")
-	}
+	return cmd.WithProjectHooks("sync:purge", func() error {
+		return cmd.withSyncDriver(ctx, "Purging sync with volume", SyncDriver.Purge)
+	})
+}
 
-	volumeName, workingDir, err := cmd.initializeSettings(ctx.String("dir"))
+// withSyncDriver runs an operation of the configured sync driver on each sync
+// target described by the command line. Every target is attempted, returning
+// the first failure.
+func (cmd *ProjectSync) withSyncDriver(ctx *cli.Context, action string, operation func(SyncDriver, *SyncTarget) error) error {
+	targets, err := cmd.syncTargets(ctx)
 	if err != nil {
-		return cmd.Failure(err.Error(), "SYNC-PATH-ERROR", 12)
+		return err
 	}
 
-	cmd.out.Spin("Checking for unison container...")
-	if running := util.ContainerRunning(volumeName); running {
-		cmd.out.Spin(fmt.Sprintf("Stopping Unison container (%s)", volumeName))
-		if stopErr := util.Command("docker", "container", "stop", volumeName).Run(); stopErr != nil {
-			cmd.out.Warn("Could not stop unison container (%s): Maybe it's already stopped?", volumeName)
+	var failure error
+	for _, target := range targets {
+		driver, err := cmd.NewSyncDriver(target.Mapping)
+		if err != nil {
+			err = cmd.Failure(err.Error(), "SYNC-DRIVER-UNKNOWN", 12)
 		} else {
-			cmd.out.Info("Stopped unison container (%s)", volumeName)
+			cmd.out.Verbose("%s %s using the %s driver", action, target.Volume, driver.Name())
+			err = operation(driver, target)
 		}
-	} else {
-		cmd.out.Info("No running unison container.")
-	}
-
-	logFile := cmd.LogFileName(volumeName)
-	cmd.out.Spin(fmt.Sprintf("Removing unison log file: %s", logFile))
-	if util.FileExists(logFile, workingDir) {
-		if removeErr := util.RemoveFile(logFile, workingDir); removeErr != nil {
-			cmd.out.Error("Could not remove unison log file: %s: %s", logFile, removeErr.Error())
-		} else {
-			cmd.out.Info("Removed unison log file: %s", logFile)
+		if err != nil && failure == nil {
+			failure = err
 		}
-	} else {
-		cmd.out.Info("Log file does not exist")
 	}
 
-	// Remove sync fragment files.
-	cmd.out.Spin("Removing .unison directories")
-	if removeGlobErr := util.RemoveFileGlob("*.unison*", workingDir, cmd.out); removeGlobErr != nil {
-		cmd.out.Warning("Could not remove .unison directories: %s", removeGlobErr)
-	} else {
-		cmd.out.Info("Removed all .unison directories")
-	}
-
-	cmd.out.Spin(fmt.Sprintf("Removing sync volume: %s", volumeName))
-	// @TODO capture the volume rm error text to display to user!
-	out, rmErr := util.Command("docker", "volume", "rm", "--force", volumeName).CombinedOutput()
-	if rmErr != nil {
-		fmt.Println(rmErr.Error())
-		return cmd.Failure(string(out), "SYNC-VOLUME-REMOVE-FAILURE", 13)
-	}
-
-	cmd.out.Info("Sync volume (%s) removed", volumeName)
-	return nil
+	return failure
 }
 
-// initializeSettings pulls together the configuration and contextual settings
-// used for all sync operations.
-func (cmd *ProjectSync) initializeSettings(dir string) (string, string, error) {
-	cmd.Config = NewProjectConfig()
+// syncTargets pulls together the configuration and contextual settings used
+// for all sync operations: a target for every sync mapping, or only the one
+// for the volume chosen with --volume.
+func (cmd *ProjectSync) syncTargets(ctx *cli.Context) ([]*SyncTarget, error) {
+	var err error
+	if cmd.Config, err = LoadProjectConfig(); err != nil {
+		return nil, cmd.Failure(err.Error(), "RIG-VERSION-UNSUPPORTED", 12)
+	}
 	if cmd.Config.NotEmpty() {
 		cmd.out.Verbose("Loaded project configuration from %s", cmd.Config.Path)
 	}
 
 	// Determine the working directory for CWD-sensitive operations.
-	var workingDir, err = cmd.DeriveLocalSyncPath(cmd.Config, dir)
+	projectDir, err := cmd.DeriveLocalSyncPath(cmd.Config, ctx.String("dir"))
 	if err != nil {
-		return "", "", err
+		return nil, cmd.Failure(err.Error(), "SYNC-PATH-ERROR", 12)
 	}
 
-	// Determine the volume name to be used across all operating systems.
-	// For cross-compatibility the way this volume is set up will vary.
-	volumeName := cmd.GetVolumeName(cmd.Config, workingDir)
+	mappings := cmd.Config.Sync
+	if len(mappings) == 0 {
+		mappings = SyncMappings{&Sync{}}
+	}
 
-	return volumeName, workingDir, nil
-}
+	targets := []*SyncTarget{}
+	for _, mapping := range mappings {
+		if mapping == nil {
+			continue
+		}
+		workingDir := projectDir
+		if mapping.Path != "" {
+			if workingDir, err = cmd.DeriveLocalSyncPath(cmd.Config, filepath.Join(projectDir, mapping.Path)); err != nil {
+				return nil, cmd.Failure(err.Error(), "SYNC-PATH-ERROR", 12)
+			}
+		}
 
-// StartUnisonSync will create and launch the volumes and containers on systems that need/support Unison
-func (cmd *ProjectSync) StartUnisonSync(ctx *cli.Context, volumeName string, config *ProjectConfig, workingDir string) error {
-	cmd.out.Spin("Starting Outrigger Filesync (unison)...")
+		// Determine the volume name to be used across all operating systems.
+		// For cross-compatibility the way this volume is set up will vary.
+		volumeName := cmd.GetVolumeName(mapping, workingDir)
+		if selected := ctx.String("volume"); selected != "" && selected != volumeName {
+			continue
+		}
 
-	// Ensure the processes can handle a large number of watches
-	if err := cmd.machine.SetSysctl("fs.inotify.max_user_watches", maxWatches); err != nil {
-		cmd.Failure(fmt.Sprintf("Failure configuring file watches on Docker Machine: %v", err), "INOTIFY-WATCH-FAILURE", 12) // nolint: gosec
+		targets = append(targets, &SyncTarget{
+			Volume:  volumeName,
+			Dir:     workingDir,
+			Config:  cmd.Config,
+			Mapping: mapping,
+			Timeout: ctx.Int("initial-sync-timeout"),
+			Wait:    ctx.Int("initial-sync-wait"),
+		})
 	}
-
-	cmd.out.SpinWithVerbose("Starting sync volume: %s", volumeName)
-	if err := util.Command("docker", "volume", "create", volumeName).Run(); err != nil {
-		return cmd.Failure(fmt.Sprintf("Failed to create sync volume: %s", volumeName), "VOLUME-CREATE-FAILED", 13)
+	if len(targets) == 0 {
+		return nil, cmd.Failure(fmt.Sprintf("No sync mapping of the project uses the volume '%s'", ctx.String("volume")), "SYNC-VOLUME-NOT-FOUND", 12)
 	}
-	cmd.out.Info("Sync volume '%s' created", volumeName)
-	cmd.out.SpinWithVerbose(fmt.Sprintf("Starting sync container: %s (same name)", volumeName))
-	unisonMinorVersion := util.GetUnisonMinorVersion()
 
-	cmd.out.Verbose("Local Unison version for compatibility: %s", unisonMinorVersion)
-	util.Command("docker", "container", "stop", volumeName).Run() // nolint: gosec
-	containerArgs := []string{
-		"container", "run", "--detach", "--rm",
-		"-v", fmt.Sprintf("%s:/unison", volumeName),
-		"-e", "UNISON_DIR=/unison",
-		"-l", fmt.Sprintf("com.dnsdock.name=%s", volumeName),
-		"-l", "com.dnsdock.image=volume.outrigger",
-		"--name", volumeName,
-		fmt.Sprintf("outrigger/unison:%s", unisonMinorVersion),
-	}
-	if err := util.Command("docker", containerArgs...).Run(); err != nil {
-		cmd.Failure(fmt.Sprintf("Failure starting sync container %s: %v", volumeName, err), "SYNC-CONTAINER-START-FAILED", 13) // nolint: gosec
-	}
+	return targets, nil
+}
 
-	ip, err := cmd.WaitForUnisonContainer(volumeName, ctx.Int("initial-sync-timeout"))
+// RunStatus executes the `rig project sync:status` command to report on the file sync.
+func (cmd *ProjectSync) RunStatus(ctx *cli.Context) error {
+	targets, err := cmd.syncTargets(ctx)
 	if err != nil {
-		return cmd.Failure(err.Error(), "SYNC-INIT-FAILED", 13)
-	}
-	cmd.out.Info("Sync container '%s' started", volumeName)
-	cmd.out.SpinWithVerbose("Initializing file sync...")
-
-	// Determine the location of the local Unison log file.
-	var logFile = cmd.LogFileName(volumeName)
-	// Remove the log file, the existence of the log file will mean that sync is
-	// up and running. If the logfile does not exist, do not complain. If the
-	// filesystem cannot delete the file when it exists, it will lead to errors.
-	if removeErr := util.RemoveFile(logFile, workingDir); removeErr != nil {
-		cmd.out.Verbose("Could not remove Unison log file: %s: %s", logFile, removeErr.Error())
-	}
-
-	// Initiate local Unison process.
-	unisonArgs := []string{
-		".",
-		fmt.Sprintf("socket://%s:%d/", ip, unisonPort),
-		"-auto", "-batch", "-silent", "-contactquietly",
-		"-repeat", "watch",
-		"-prefer", ".",
-		"-logfile", logFile,
-		"-ignore", fmt.Sprintf("Name %s", logFile),
-	}
-	// Append ProjectConfig ignores here
-	if config.Sync != nil {
-		for _, ignore := range config.Sync.Ignore {
-			unisonArgs = append(unisonArgs, "-ignore", ignore)
-		}
+		return err
 	}
 
-	/* #nosec */
-	command := exec.Command("unison", unisonArgs...)
-	command.Dir = workingDir
-	cmd.out.Verbose("Sync execution - Working Directory: %s", workingDir)
-	if err = util.Convert(command).Start(); err != nil {
-		return cmd.Failure(fmt.Sprintf("Failure starting local Unison process: %v", err), "UNISON-START-FAILED", 13)
+	statuses := []*SyncStatus{}
+	for _, target := range targets {
+		driver, err := cmd.NewSyncDriver(target.Mapping)
+		if err != nil {
+			return cmd.Failure(err.Error(), "SYNC-DRIVER-UNKNOWN", 12)
+		}
+		status, err := driver.Status(target)
+		if err != nil {
+			return cmd.Failure(err.Error(), "SYNC-STATUS-FAILED", 12)
+		}
+		statuses = append(statuses, status)
 	}
 
-	if err := cmd.WaitForSyncInit(logFile, workingDir, ctx.Int("initial-sync-timeout"), ctx.Int("initial-sync-wait")); err != nil {
-		return cmd.Failure(err.Error(), "UNISON-SYNC-FAILED", 13)
+	switch format := ctx.String("format"); format {
+	case "table":
+		for i, status := range statuses {
+			if i > 0 {
+				fmt.Println()
+			}
+			printSyncStatus(status)
+		}
+	case "json":
+		output, err := json.MarshalIndent(statuses, "", "  ")
+		if err != nil {
+			return cmd.Failure(err.Error(), "COMMAND-ERROR", 12)
+		}
+		fmt.Println(string(output))
+	default:
+		return cmd.Failure(fmt.Sprintf("Unknown format '%s', expected table or json", format), "INVALID-FORMAT", 12)
 	}
 
-	cmd.out.Info("Watch unison process activities in the sync log: %s", logFile)
-
-	return cmd.Success("Unison sync started successfully")
+	return nil
 }
 
-// SetupBindVolume will create minimal Docker Volumes for systems that have native container/volume support
-func (cmd *ProjectSync) SetupBindVolume(volumeName string, workingDir string) error {
-	cmd.out.SpinWithVerbose("Starting local bind volume: %s", volumeName)
-	util.Command("docker", "volume", "rm", volumeName).Run() // nolint: gosec
-
-	volumeArgs := []string{
-		"volume", "create",
-		"--opt", "type=none",
-		"--opt", fmt.Sprintf("device=%s", workingDir),
-		"--opt", "o=bind",
-		volumeName,
+// printSyncStatus prints the status of a sync as aligned columns.
+func printSyncStatus(status *SyncStatus) {
+	running := func(state *bool) string {
+		if state == nil {
+			return "unknown"
+		} else if *state {
+			return "running"
+		}
+		return "not running"
 	}
 
-	if err := util.Command("docker", volumeArgs...).Run(); err != nil {
-		return cmd.Failure(err.Error(), "BIND-VOLUME-FAILURE", 13)
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(writer, "Driver:\t%s\n", status.Driver)
+	if status.VolumeExists {
+		fmt.Fprintf(writer, "Volume:\t%s\n", status.Volume)
+	} else {
+		fmt.Fprintf(writer, "Volume:\t%s (missing)\n", status.Volume)
 	}
-
-	return cmd.Success("Bind volume created")
+	fmt.Fprintf(writer, "Directory:\t%s\n", status.Dir)
+	if status.Container != nil {
+		fmt.Fprintf(writer, "Container:\t%s\n", running(status.Container))
+	}
+	if status.Process != nil {
+		fmt.Fprintf(writer, "Process:\t%s\n", running(status.Process))
+	}
+	if status.Supervisor != "" {
+		fmt.Fprintf(writer, "Supervisor:\t%s, %d restart(s)\n", status.Supervisor, status.Restarts)
+		if status.LastExit != "" {
+			fmt.Fprintf(writer, "Last exit:\t%s\n", status.LastExit)
+		}
+	}
+	if status.LastSync != nil {
+		fmt.Fprintf(writer, "Last sync:\t%s (%s ago)\n", status.LastSync.Format("2006-01-02 15:04:05"), time.Since(*status.LastSync).Round(time.Second))
+	} else if status.LogFile != "" {
+		fmt.Fprintf(writer, "Last sync:\tnever\n")
+	}
+	if status.LogFile != "" {
+		fmt.Fprintf(writer, "Propagated:\t%d item(s)\n", status.Propagated)
+		fmt.Fprintf(writer, "Conflicts:\t%d\n", len(status.Conflicts))
+		for _, conflict := range status.Conflicts {
+			fmt.Fprintf(writer, "\t%s\n", conflict)
+		}
+		fmt.Fprintf(writer, "Errors:\t%d\n", len(status.Errors))
+		for _, problem := range status.Errors {
+			fmt.Fprintf(writer, "\t%s\n", problem)
+		}
+		fmt.Fprintf(writer, "Log file:\t%s\n", status.LogFile)
+	}
+	writer.Flush() // nolint: gosec
 }
 
 // LogFileName gets the unison sync file name.
@@ -417,19 +439,17 @@ func (cmd *ProjectSync) LogFileName(name string) string {
 	return fmt.Sprintf("%s.log", name)
 }
 
-// GetVolumeName will find the volume name through a variety of fall backs
-func (cmd *ProjectSync) GetVolumeName(config *ProjectConfig, workingDir string) string {
+// GetVolumeName will find the volume name of a sync mapping through a variety of fall backs
+func (cmd *ProjectSync) GetVolumeName(mapping *Sync, workingDir string) string {
 	// 1. Check for config
-	if config.Sync != nil && config.Sync.Volume != "" {
-		return config.Sync.Volume
+	if mapping.Volume != "" {
+		return mapping.Volume
 	}
 
 	// 2. Parse compose file looking for an external volume named *-sync
 	if composeConfig, err := cmd.LoadComposeFile(); err == nil {
-		for name, volume := range composeConfig.Volumes {
-			if strings.HasSuffix(name, "-sync") && volume.External {
-				return name
-			}
+		if name := composeConfig.SyncVolume(); name != "" {
+			return name
 		}
 	}
 
@@ -438,6 +458,23 @@ func (cmd *ProjectSync) GetVolumeName(config *ProjectConfig, workingDir string)
 	return fmt.Sprintf("%s-sync", folder)
 }
 
+// SyncVolume finds the external volume named *-sync, if any, preferring the
+// first by name.
+func (f *ComposeFile) SyncVolume() string {
+	names := []string{}
+	for name, volume := range f.Volumes {
+		if strings.HasSuffix(name, "-sync") && volume.External {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+
+	return names[0]
+}
+
 // LoadComposeFile will load the proper compose file
 func (cmd *ProjectSync) LoadComposeFile() (*ComposeFile, error) {
 	yamlFile, err := ioutil.ReadFile("./docker-compose.yml")
@@ -0,0 +1,255 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/phase2/rig/util"
+)
+
+// SyncDriver keeps a Docker volume up to date with the project directory. It
+// is selected by the 'driver' sync setting and backs every sync:* command.
+type SyncDriver interface {
+	// Name identifies the driver in the sync settings.
+	Name() string
+	// Start creates the volume and begins keeping it in sync.
+	Start(target *SyncTarget) error
+	// Stop ends the sync, leaving the volume in place.
+	Stop(target *SyncTarget) error
+	// Check tests the sync is running and healthy.
+	Check(target *SyncTarget) error
+	// Status reports on the state of the sync without changing it.
+	Status(target *SyncTarget) (*SyncStatus, error)
+	// Purge stops the sync and removes the volume along with any state kept
+	// for it.
+	Purge(target *SyncTarget) error
+}
+
+// SyncTarget describes the volume synced with a directory.
+type SyncTarget struct {
+	Volume string
+	Dir    string
+	Config *ProjectConfig
+	// Mapping holds the sync settings of the directory.
+	Mapping *Sync
+	// Timeout is the time in seconds allowed for each stage of starting the
+	// sync, and Wait the time between checks for the initial sync to finish.
+	Timeout int
+	Wait    int
+}
+
+// SyncStatus reports on the state of a sync for `rig project sync:status`.
+type SyncStatus struct {
+	Driver string `json:"driver"`
+	Volume string `json:"volume"`
+	Dir    string `json:"dir"`
+	// VolumeExists is whether Docker has the volume.
+	VolumeExists bool `json:"volume_exists"`
+	// Container and Process report whether the sync container and the local
+	// sync process are running, or are nil for drivers without them.
+	Container *bool `json:"container,omitempty"`
+	Process   *bool `json:"process,omitempty"`
+	// Supervisor is the state of the supervisor keeping the local sync
+	// process running, which restarted it Restarts times, most recently after
+	// LastExit.
+	Supervisor string `json:"supervisor,omitempty"`
+	Restarts   int    `json:"restarts,omitempty"`
+	LastExit   string `json:"last_exit,omitempty"`
+	// LogFile is the sync log the remaining fields are read from, if any.
+	LogFile    string     `json:"log_file,omitempty"`
+	LastSync   *time.Time `json:"last_sync,omitempty"`
+	Propagated int        `json:"propagated"`
+	Conflicts  []string   `json:"conflicts"`
+	Errors     []string   `json:"errors"`
+}
+
+// newSyncStatus starts the status of a sync target, checking the volume exists.
+func newSyncStatus(driver SyncDriver, target *SyncTarget) *SyncStatus {
+	return &SyncStatus{
+		Driver:       driver.Name(),
+		Volume:       target.Volume,
+		Dir:          target.Dir,
+		VolumeExists: util.Command("docker", "volume", "inspect", target.Volume).Run() == nil,
+		Conflicts:    []string{},
+		Errors:       []string{},
+	}
+}
+
+// syncDrivers creates the drivers which may be selected by name.
+var syncDrivers = map[string]func(cmd *ProjectSync) SyncDriver{
+	"unison":      func(cmd *ProjectSync) SyncDriver { return &UnisonSyncDriver{cmd} },
+	"bind":        func(cmd *ProjectSync) SyncDriver { return &BindSyncDriver{cmd} },
+	"copy":        func(cmd *ProjectSync) SyncDriver { return &CopySyncDriver{cmd} },
+	"rsync-watch": func(cmd *ProjectSync) SyncDriver { return &RsyncWatchSyncDriver{cmd} },
+}
+
+// SyncDriverNames lists the drivers which may be selected in the sync settings.
+func SyncDriverNames() []string {
+	return []string{"unison", "bind", "copy", "rsync-watch"}
+}
+
+// DefaultSyncDriverName is the driver used without a sync setting: a bind
+// volume where Docker runs natively, otherwise unison.
+func DefaultSyncDriverName() string {
+	if util.SupportsNativeDocker() {
+		return "bind"
+	}
+
+	return "unison"
+}
+
+// NewSyncDriver creates the driver configured for a sync mapping, or the default.
+func (cmd *ProjectSync) NewSyncDriver(mapping *Sync) (SyncDriver, error) {
+	name := DefaultSyncDriverName()
+	if mapping != nil && mapping.Driver != "" {
+		name = mapping.Driver
+	}
+
+	create, ok := syncDrivers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown sync driver '%s', expected one of: %s", name, strings.Join(SyncDriverNames(), ", "))
+	}
+
+	return create(cmd), nil
+}
+
+// BindSyncDriver mounts the project directory as the volume, for Docker
+// running natively where no copy of the files is needed.
+type BindSyncDriver struct {
+	cmd *ProjectSync
+}
+
+// Name identifies the driver in the sync settings.
+func (d *BindSyncDriver) Name() string {
+	return "bind"
+}
+
+// Start creates the volume as a bind mount of the project directory.
+func (d *BindSyncDriver) Start(target *SyncTarget) error {
+	d.cmd.out.SpinWithVerbose("Starting local bind volume: %s", target.Volume)
+	util.Command("docker", "volume", "rm", target.Volume).Run() // nolint: gosec
+
+	volumeArgs := []string{
+		"volume", "create",
+		"--opt", "type=none",
+		"--opt", fmt.Sprintf("device=%s", target.Dir),
+		"--opt", "o=bind",
+		target.Volume,
+	}
+
+	if err := util.Command("docker", volumeArgs...).Run(); err != nil {
+		return d.cmd.Failure(err.Error(), "BIND-VOLUME-FAILURE", 13)
+	}
+
+	return d.cmd.Success("Bind volume created")
+}
+
+// Stop has nothing to do, the volume always reflects the project directory.
+func (d *BindSyncDriver) Stop(target *SyncTarget) error {
+	return d.cmd.Success("No sync process to stop, using local bind volume")
+}
+
+// Check checks the volume is bound to the project directory.
+func (d *BindSyncDriver) Check(target *SyncTarget) error {
+	d.cmd.out.Spin(fmt.Sprintf("Checking bind volume %s...", target.Volume))
+	output, err := util.Command("docker", "volume", "inspect", "--format", `{{index .Options "device"}}`, target.Volume).Output()
+	if err != nil {
+		return d.cmd.Failure(fmt.Sprintf("Bind volume (%s) does not exist. Run 'rig project sync:start' to create it", target.Volume), "SYNC-CHECK-FAILED", 13)
+	}
+	if device := strings.TrimSpace(string(output)); device != target.Dir {
+		return d.cmd.Failure(fmt.Sprintf("Bind volume (%s) mounts %s rather than %s. Run 'rig project sync:start' to recreate it", target.Volume, device, target.Dir), "SYNC-CHECK-FAILED", 13)
+	}
+
+	d.cmd.out.Info("Bind volume (%s) mounts %s", target.Volume, target.Dir)
+	return nil
+}
+
+// Status reports whether the volume exists.
+func (d *BindSyncDriver) Status(target *SyncTarget) (*SyncStatus, error) {
+	return newSyncStatus(d, target), nil
+}
+
+// Purge removes the volume, leaving the project directory untouched.
+func (d *BindSyncDriver) Purge(target *SyncTarget) error {
+	return d.cmd.removeSyncVolume(target.Volume)
+}
+
+// CopySyncDriver copies the project directory into the volume once, for
+// read-only uses such as CI where changes need not be synced as they happen.
+type CopySyncDriver struct {
+	cmd *ProjectSync
+}
+
+// Name identifies the driver in the sync settings.
+func (d *CopySyncDriver) Name() string {
+	return "copy"
+}
+
+// Start creates the volume and copies the project directory into it with
+// rsync, leaving out ignored paths and replacing any earlier copy.
+func (d *CopySyncDriver) Start(target *SyncTarget) error {
+	filters, err := d.cmd.RsyncFilters(target)
+	if err != nil {
+		return d.cmd.Failure(err.Error(), "SYNC-IGNORE-FAILED", 12)
+	}
+
+	d.cmd.out.SpinWithVerbose("Creating sync volume: %s", target.Volume)
+	if err := util.Command("docker", "volume", "create", target.Volume).Run(); err != nil {
+		return d.cmd.Failure(fmt.Sprintf("Failed to create sync volume: %s", target.Volume), "VOLUME-CREATE-FAILED", 13)
+	}
+
+	d.cmd.out.SpinWithVerbose("Copying %s to volume %s", target.Dir, target.Volume)
+	copyArgs := []string{
+		"container", "run", "--rm",
+		"-v", fmt.Sprintf("%s:/source:ro", target.Dir),
+		"-v", fmt.Sprintf("%s:/sync", target.Volume),
+		"--entrypoint", "rsync",
+		rsyncImage,
+		"-a", "--delete", "--delete-excluded",
+	}
+	copyArgs = append(append(copyArgs, filters...), "/source/", "/sync/")
+	if output, err := util.Command("docker", copyArgs...).CombinedOutput(); err != nil {
+		return d.cmd.Failure(fmt.Sprintf("Failure copying files to volume %s: %v %s", target.Volume, err, strings.TrimSpace(string(output))), "SYNC-COPY-FAILED", 13)
+	}
+
+	return d.cmd.Success(fmt.Sprintf("Copied files to volume '%s'. Run 'rig project sync:start' again to copy later changes", target.Volume))
+}
+
+// Stop has nothing to do, the copy runs to completion when started.
+func (d *CopySyncDriver) Stop(target *SyncTarget) error {
+	return d.cmd.Success("No sync process to stop, files are copied once by sync:start")
+}
+
+// Check checks the volume exists.
+func (d *CopySyncDriver) Check(target *SyncTarget) error {
+	d.cmd.out.Spin(fmt.Sprintf("Checking sync volume %s...", target.Volume))
+	if err := util.Command("docker", "volume", "inspect", target.Volume).Run(); err != nil {
+		return d.cmd.Failure(fmt.Sprintf("Sync volume (%s) does not exist. Run 'rig project sync:start' to create it", target.Volume), "SYNC-CHECK-FAILED", 13)
+	}
+
+	d.cmd.out.Info("Sync volume (%s) holds a copy of %s", target.Volume, target.Dir)
+	return nil
+}
+
+// Status reports whether the volume exists.
+func (d *CopySyncDriver) Status(target *SyncTarget) (*SyncStatus, error) {
+	return newSyncStatus(d, target), nil
+}
+
+// Purge removes the volume.
+func (d *CopySyncDriver) Purge(target *SyncTarget) error {
+	return d.cmd.removeSyncVolume(target.Volume)
+}
+
+// removeSyncVolume removes the sync volume, whatever the driver.
+func (cmd *ProjectSync) removeSyncVolume(volumeName string) error {
+	cmd.out.Spin(fmt.Sprintf("Removing sync volume: %s", volumeName))
+	out, rmErr := util.Command("docker", "volume", "rm", "--force", volumeName).CombinedOutput()
+	if rmErr != nil {
+		return cmd.Failure(strings.TrimSpace(string(out)), "SYNC-VOLUME-REMOVE-FAILURE", 13)
+	}
+
+	cmd.out.Info("Sync volume (%s) removed", volumeName)
+	return nil
+}
@@ -0,0 +1,70 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSyncDriverSelection(t *testing.T) {
+	cmd := &ProjectSync{}
+	driver, err := cmd.NewSyncDriver(nil)
+	if err != nil || driver.Name() != DefaultSyncDriverName() {
+		t.Errorf("expected the default driver without a setting, got %v (%v)", driver, err)
+	}
+	for _, name := range SyncDriverNames() {
+		if driver, err := cmd.NewSyncDriver(&Sync{Driver: name}); err != nil || driver.Name() != name {
+			t.Errorf("expected the %s driver, got %v (%v)", name, driver, err)
+		}
+	}
+	if _, err := cmd.NewSyncDriver(&Sync{Driver: "rsync"}); err == nil {
+		t.Error("expected an unknown driver to be rejected")
+	}
+
+	document := parseTestConfig(t, "version: 2.0\nsync:\n  driver: rsync\n")
+	if problems := ValidateProjectConfigSchema("outrigger.yml", document); len(problems) != 1 {
+		t.Errorf("expected the unknown driver to be reported, got %v", problems)
+	}
+}
+
+func TestRsyncFilters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rig-sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = ioutil.WriteFile(filepath.Join(dir, ".gitignore"), []byte("*.log\n!keep.log\n/vendor/\ndocs/_build\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := &ProjectSync{}
+	target := &SyncTarget{Volume: "site-sync", Dir: dir, Mapping: &Sync{
+		Ignore:     SyncIgnores{"Name node_modules", "Path build/logs", "BelowPath cache"},
+		IgnoreFrom: []string{".gitignore"},
+	}}
+	filters, err := cmd.RsyncFilters(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"--include=keep.log",
+		"--exclude=site-sync.log",
+		"--exclude=node_modules",
+		"--exclude=/build/logs",
+		"--exclude=/cache",
+		"--exclude=*.log",
+		"--exclude=/vendor",
+		"--exclude=/docs/_build",
+	}
+	if !reflect.DeepEqual(filters, expected) {
+		t.Errorf("unexpected rsync filters:\n%s", strings.Join(filters, "\n"))
+	}
+
+	target.Mapping.Ignore = SyncIgnores{`Regex build/backups/.*\.sql`}
+	if _, err := cmd.RsyncFilters(target); err == nil || !strings.Contains(err.Error(), "can not be applied by rsync") {
+		t.Errorf("expected the regex rule to be refused, found: %v", err)
+	}
+}
@@ -0,0 +1,423 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli"
+)
+
+// SyncIgnoreRule is a unison ignore rule along with where it came from.
+type SyncIgnoreRule struct {
+	// Rule is in unison syntax, such as "Path vendor".
+	Rule string
+	// Not marks an exception to the other rules, from a negated pattern such
+	// as "!keep.log", which is passed to unison with -ignorenot.
+	Not bool
+	// Source describes where the rule was read from, such as ".gitignore:3".
+	Source string
+	// name is the pattern for the last part of the paths matched by a rule
+	// read from an ignore file, such as "*.log".
+	name string
+	// pattern is the ignore file pattern a rule was read from, rooted with a
+	// leading slash when it only matches from the top of the directory.
+	pattern string
+}
+
+// Flag is the unison option passing the rule.
+func (r *SyncIgnoreRule) Flag() string {
+	if r.Not {
+		return "-ignorenot"
+	}
+
+	return "-ignore"
+}
+
+// ignoresCommand lists and tests the ignore rules of the sync.
+func (cmd *ProjectSync) ignoresCommand() cli.Command {
+	return cli.Command{
+		Name:        "sync:ignores",
+		Category:    "File Sync",
+		Usage:       "List the ignore rules of the file sync, or test which one matches a path.",
+		Description: "Lists the rules passed to unison, which the copy and rsync-watch drivers translate for rsync: the sync log, the ignore setting of the project configuration and the patterns of the files named by the ignore_from setting, such as .gitignore and .dockerignore.\n\n\tWith --check the path, relative to the current directory, is tested against the rules instead, showing the rule which ignores it if any.",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "check",
+				Value: "",
+				Usage: "A path to test against the ignore rules rather than listing them.",
+			},
+			// Override the local sync path.
+			cli.StringFlag{
+				Name:  "dir",
+				Value: "",
+				Usage: "Specify the location in the local filesystem to be synced. If not used it will look for the directory of project configuration or fall back to current working directory. Use '--dir=.' to guarantee current working directory is used.",
+			},
+			// Choose one of several sync mappings.
+			cli.StringFlag{
+				Name:  "volume",
+				Value: "",
+				Usage: "Only operate on the sync mapping for this volume, rather than every mapping of the project configuration.",
+			},
+		},
+		Before: cmd.Before,
+		Action: cmd.RunIgnores,
+	}
+}
+
+// RunIgnores executes the `rig project sync:ignores` command to list the
+// ignore rules of each sync target or test a path against them.
+func (cmd *ProjectSync) RunIgnores(ctx *cli.Context) error {
+	targets, err := cmd.syncTargets(ctx)
+	if err != nil {
+		return err
+	}
+
+	var checkPath string
+	if check := ctx.String("check"); check != "" {
+		if checkPath, err = filepath.Abs(check); err != nil {
+			return cmd.Failure(err.Error(), "SYNC-PATH-ERROR", 12)
+		}
+	}
+
+	checked := false
+	for i, target := range targets {
+		driver, err := cmd.NewSyncDriver(target.Mapping)
+		if err != nil {
+			return cmd.Failure(err.Error(), "SYNC-DRIVER-UNKNOWN", 12)
+		}
+		rules, err := cmd.SyncIgnoreRules(target)
+		if err != nil {
+			return cmd.Failure(err.Error(), "SYNC-IGNORE-FAILED", 12)
+		}
+		switch driver.Name() {
+		case "bind":
+			cmd.out.Warning("The %s driver syncing volume %s does not apply ignore rules", driver.Name(), target.Volume)
+		case "copy", "rsync-watch":
+			for _, rule := range rules {
+				if _, err := rule.RsyncPattern(); err != nil {
+					cmd.out.Warning("%s", err)
+				}
+			}
+		}
+
+		if checkPath == "" {
+			if i > 0 {
+				fmt.Println()
+			}
+			printSyncIgnoreRules(target, rules)
+			continue
+		}
+
+		relative, err := filepath.Rel(target.Dir, checkPath)
+		if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+			continue
+		}
+		checked = true
+		relative = filepath.ToSlash(relative)
+		ignored, kept := MatchSyncIgnoreRules(rules, relative)
+		switch {
+		case ignored != nil:
+			fmt.Printf("%s is ignored syncing volume %s by '%s' from %s\n", relative, target.Volume, ignored.Rule, ignored.Source)
+		case kept != nil:
+			fmt.Printf("%s is synced to volume %s, kept by '%s' from %s\n", relative, target.Volume, kept.Rule, kept.Source)
+		default:
+			fmt.Printf("%s is synced to volume %s, no rule matches\n", relative, target.Volume)
+		}
+	}
+	if checkPath != "" && !checked {
+		return cmd.Failure(fmt.Sprintf("%s is not within a synced directory", ctx.String("check")), "SYNC-PATH-ERROR", 12)
+	}
+
+	return nil
+}
+
+// printSyncIgnoreRules prints the ignore rules of a sync target as aligned columns.
+func printSyncIgnoreRules(target *SyncTarget, rules []*SyncIgnoreRule) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(writer, "Volume:\t%s\n", target.Volume)
+	fmt.Fprintf(writer, "Directory:\t%s\n", target.Dir)
+	fmt.Fprintln(writer)
+	fmt.Fprintf(writer, "OPTION\tRULE\tSOURCE\n")
+	for _, rule := range rules {
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", rule.Flag(), rule.Rule, rule.Source)
+	}
+	writer.Flush() // nolint: gosec
+}
+
+// SyncIgnoreRules collects the unison ignore rules of a sync target: the sync
+// log, the ignore setting and the patterns of the files named by the
+// ignore_from setting. Pattern files which do not exist are skipped.
+func (cmd *ProjectSync) SyncIgnoreRules(target *SyncTarget) ([]*SyncIgnoreRule, error) {
+	rules := []*SyncIgnoreRule{{Rule: fmt.Sprintf("Name %s", cmd.LogFileName(target.Volume)), Source: "sync log"}}
+	if target.Mapping == nil {
+		return rules, nil
+	}
+
+	for _, ignore := range target.Mapping.Ignore {
+		rules = append(rules, &SyncIgnoreRule{Rule: ignore, Source: "project configuration"})
+	}
+	for _, name := range target.Mapping.IgnoreFrom {
+		file, err := os.Open(filepath.Join(target.Dir, name))
+		if os.IsNotExist(err) {
+			cmd.out.Verbose("Skipping missing ignore file %s", name)
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("Could not read ignore file: %s", err)
+		}
+		patterns, err := ReadIgnorePatterns(file, filepath.ToSlash(name), strings.Contains(filepath.Base(name), "dockerignore"))
+		file.Close() // nolint: gosec
+		if err != nil {
+			return nil, fmt.Errorf("Could not read ignore file %s: %s", name, err)
+		}
+		rules = append(rules, patterns...)
+	}
+
+	return rules, CheckIgnoreRuleOrder(rules)
+}
+
+// CheckIgnoreRuleOrder makes sure unison applies the rules as ignore files
+// would. In ignore files the last matching pattern wins, while unison keeps
+// every path matching an exception. The two only differ for a path matched by
+// an exception and a later rule, so such rules are refused. Rules which might
+// match the same name are treated as matching the same path.
+func CheckIgnoreRuleOrder(rules []*SyncIgnoreRule) error {
+	for i, exception := range rules {
+		if !exception.Not {
+			continue
+		}
+		for _, rule := range rules[i+1:] {
+			if !rule.Not && ignoreNamesOverlap(exception.name, rule.name) {
+				return fmt.Errorf("'%s' from %s may ignore paths kept by the earlier '!%s' from %s, which unison can not represent. Move the exception after it", rule.Rule, rule.Source, exception.Rule, exception.Source)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ignoreNamesOverlap tells whether two ignore file patterns for the last part
+// of a path might match the same name. Patterns with wildcards are compared
+// by the text before their first wildcard and after their last one. An
+// unknown pattern might match any name.
+func ignoreNamesOverlap(a, b string) bool {
+	wildcards := "*?["
+	switch {
+	case a == "" || b == "":
+		return true
+	case !strings.ContainsAny(a, wildcards) && !strings.ContainsAny(b, wildcards):
+		return a == b
+	case !strings.ContainsAny(a, wildcards):
+		return regexp.MustCompile("^" + ignorePatternRegexp(b) + "$").MatchString(a)
+	case !strings.ContainsAny(b, wildcards):
+		return regexp.MustCompile("^" + ignorePatternRegexp(a) + "$").MatchString(b)
+	}
+
+	prefixA, prefixB := a[:strings.IndexAny(a, wildcards)], b[:strings.IndexAny(b, wildcards)]
+	suffixA, suffixB := a[strings.LastIndexAny(a, "*?]")+1:], b[strings.LastIndexAny(b, "*?]")+1:]
+	return (strings.HasPrefix(prefixA, prefixB) || strings.HasPrefix(prefixB, prefixA)) &&
+		(strings.HasSuffix(suffixA, suffixB) || strings.HasSuffix(suffixB, suffixA))
+}
+
+// ReadIgnorePatterns translates the patterns of a .gitignore style file into
+// unison ignore rules. Patterns of .dockerignore files are rooted, only
+// matching from the top of the directory, rather than also matching names in
+// any directory like those of .gitignore files.
+//
+// Unison cannot tell directories from files, so patterns only matching
+// directories are applied to both. Negated patterns become exceptions, which
+// unison applies whatever their order, see CheckIgnoreRuleOrder.
+func ReadIgnorePatterns(reader io.Reader, source string, rooted bool) ([]*SyncIgnoreRule, error) {
+	rules := []*SyncIgnoreRule{}
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		if rule := ignorePatternRule(scanner.Text(), rooted); rule != nil {
+			rule.Source = fmt.Sprintf("%s:%d", source, line)
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules, scanner.Err()
+}
+
+// ignorePatternRule translates a line of an ignore file into a unison rule:
+// Name for patterns matching in any directory and Path for those matching
+// from the top of the directory. Unison wildcards at the start of a name do
+// not match a leading dot, unlike those of ignore files, so such patterns and
+// those using **, character classes, braces or escapes become Regex rules.
+func ignorePatternRule(line string, rooted bool) *SyncIgnoreRule {
+	pattern := strings.TrimRight(line, " \t\r")
+	if pattern == "" || strings.HasPrefix(pattern, "#") {
+		return nil
+	}
+	rule := &SyncIgnoreRule{}
+	if strings.HasPrefix(pattern, "!") {
+		rule.Not, pattern = true, pattern[1:]
+	}
+	pattern = strings.TrimPrefix(pattern, `\`)
+	pattern = strings.TrimSuffix(pattern, "/")
+
+	rooted = rooted || strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	if rest := strings.TrimPrefix(pattern, "**/"); rest != pattern && !strings.Contains(rest, "/") {
+		pattern, rooted = rest, false
+	}
+	if pattern == "" || pattern == "**" {
+		return nil
+	}
+	rule.name = path.Base(pattern)
+	rule.pattern = pattern
+	if rooted {
+		rule.pattern = "/" + pattern
+	}
+
+	literal := !strings.ContainsAny(pattern, "{}[\\") && !strings.Contains(pattern, "**")
+	for _, part := range strings.Split(pattern, "/") {
+		literal = literal && !strings.HasPrefix(part, "*") && !strings.HasPrefix(part, "?")
+	}
+	switch {
+	case literal && rooted:
+		rule.Rule = "Path " + pattern
+	case literal:
+		rule.Rule = "Name " + pattern
+	case rooted:
+		rule.Rule = "Regex " + ignorePatternRegexp(pattern)
+	default:
+		rule.Rule = "Regex (.*/)?" + ignorePatternRegexp(pattern)
+	}
+
+	return rule
+}
+
+// ignorePatternRegexp translates an ignore file pattern using ** into a
+// regular expression, where ** matches any number of directories.
+func ignorePatternRegexp(pattern string) string {
+	var expression bytes.Buffer
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			expression.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			expression.WriteString(".*")
+			i++
+		case c == '*':
+			expression.WriteString("[^/]*")
+		case c == '?':
+			expression.WriteString("[^/]")
+		case c == '[' && strings.Contains(pattern[i:], "]"):
+			end := i + strings.Index(pattern[i:], "]")
+			class := pattern[i+1 : end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expression.WriteString("[" + class + "]")
+			i = end
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			expression.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			expression.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+
+	return expression.String()
+}
+
+// MatchSyncIgnoreRules tests a path, relative to the synced directory and
+// separated by slashes, against unison ignore rules. As unison skips the
+// contents of an ignored directory, each parent is tested before the path,
+// the last rule matching it deciding as in ignore files. The rule ignoring the
+// path is returned, or when an exception keeps a path matching some rule, the
+// exception.
+func MatchSyncIgnoreRules(rules []*SyncIgnoreRule, name string) (ignored *SyncIgnoreRule, kept *SyncIgnoreRule) {
+	parts := strings.Split(strings.Trim(path.Clean(name), "/"), "/")
+	for i := range parts {
+		prefix := strings.Join(parts[:i+1], "/")
+		var last *SyncIgnoreRule
+		matched := false
+		for _, rule := range rules {
+			if matchUnisonRule(rule.Rule, prefix) {
+				matched = matched || !rule.Not
+				last = rule
+			}
+		}
+		if last != nil && !last.Not {
+			return last, nil
+		} else if last != nil && matched {
+			kept = last
+		}
+	}
+
+	return nil, kept
+}
+
+// matchUnisonRule tests whether a unison ignore rule matches a path.
+func matchUnisonRule(rule string, name string) bool {
+	parts := strings.SplitN(rule, " ", 2)
+	if len(parts) != 2 {
+		return false
+	}
+
+	var expression string
+	switch parts[0] {
+	case "Name":
+		name = path.Base(name)
+		expression = unisonGlobRegexp(parts[1])
+	case "Path", "BelowPath":
+		expression = unisonGlobRegexp(parts[1])
+	case "Regex":
+		expression = parts[1]
+	default:
+		return false
+	}
+
+	matcher, err := regexp.Compile("^(?:" + expression + ")$")
+	return err == nil && matcher.MatchString(name)
+}
+
+// unisonGlobRegexp translates a unison glob pattern into a regular expression.
+// As in unison, * and ? match neither / nor a leading dot.
+func unisonGlobRegexp(glob string) string {
+	var expression bytes.Buffer
+	braces := 0
+	for i := 0; i < len(glob); i++ {
+		leading := i == 0 || glob[i-1] == '/'
+		switch c := glob[i]; {
+		case c == '*' && leading:
+			expression.WriteString("([^/.][^/]*)?")
+		case c == '*':
+			expression.WriteString("[^/]*")
+		case c == '?' && leading:
+			expression.WriteString("[^/.]")
+		case c == '?':
+			expression.WriteString("[^/]")
+		case c == '[' && strings.Contains(glob[i:], "]"):
+			end := i + strings.Index(glob[i:], "]")
+			expression.WriteString(glob[i : end+1])
+			i = end
+		case c == '{':
+			braces++
+			expression.WriteString("(")
+		case c == ',' && braces > 0:
+			expression.WriteString("|")
+		case c == '}' && braces > 0:
+			braces--
+			expression.WriteString(")")
+		case c == '\\' && i+1 < len(glob):
+			i++
+			expression.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			expression.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+
+	return expression.String()
+}
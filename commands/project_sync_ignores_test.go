@@ -0,0 +1,125 @@
+package commands
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSyncMappings(t *testing.T) {
+	document := parseTestConfig(t, `version: 2.0
+sync:
+  - path: services/api
+    volume: api-sync
+    ignore:
+      - path: vendor/
+  - path: services/web
+    driver: bind
+`)
+	problems := ValidateProjectConfigSchema("outrigger.yml", document)
+	if len(problems) != 1 || !strings.Contains(problems[0].Error(), "volume") {
+		t.Errorf("expected the mapping without a volume to be reported, got %v", problems)
+	}
+
+	var config ProjectConfig
+	if err := document.Decode(&config); err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Sync) != 2 || config.Sync[0].Path != "services/api" || config.Sync[0].Ignore[0] != "Path vendor/" || config.Sync[1].Driver != "bind" {
+		t.Errorf("unexpected sync mappings: %+v", config.Sync)
+	}
+
+	if err := parseTestConfig(t, "sync:\n  volume: site-sync\n").Decode(&config); err != nil || len(config.Sync) != 1 || config.Sync[0].Volume != "site-sync" {
+		t.Errorf("expected a single mapping (%v): %+v", err, config.Sync)
+	}
+}
+
+func TestReadIgnorePatterns(t *testing.T) {
+	content := `# Dependencies
+node_modules/
+/vendor
+docs/_build
+**/cache
+logs/**/*.log
+*.log
+!keep.log
+\#notes
+`
+	rules, err := ReadIgnorePatterns(strings.NewReader(content), ".gitignore", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var translated []string
+	for _, rule := range rules {
+		translated = append(translated, rule.Flag()+" "+rule.Rule)
+	}
+	expected := []string{
+		"-ignore Name node_modules",
+		"-ignore Path vendor",
+		"-ignore Path docs/_build",
+		"-ignore Name cache",
+		`-ignore Regex logs/(.*/)?[^/]*\.log`,
+		`-ignore Regex (.*/)?[^/]*\.log`,
+		"-ignorenot Name keep.log",
+		"-ignore Name #notes",
+	}
+	if !reflect.DeepEqual(translated, expected) {
+		t.Errorf("unexpected rules:\n%s", strings.Join(translated, "\n"))
+	}
+	if rules[1].Source != ".gitignore:3" {
+		t.Errorf("expected the source .gitignore:3, got %s", rules[1].Source)
+	}
+
+	rules, err = ReadIgnorePatterns(strings.NewReader("node_modules\n"), ".dockerignore", true)
+	if err != nil || len(rules) != 1 || rules[0].Rule != "Path node_modules" {
+		t.Errorf("expected a rooted rule for .dockerignore (%v): %+v", err, rules)
+	}
+
+	rules = append(rules, &SyncIgnoreRule{Rule: "Name *.log"}, &SyncIgnoreRule{Rule: "Name keep.log", Not: true}, &SyncIgnoreRule{Rule: "Name {.git,.idea}"})
+	for name, rule := range map[string]string{
+		"node_modules/react/index.js": "Path node_modules",
+		"web/node_modules":            "",
+		"logs/app.log":                "Name *.log",
+		"logs/keep.log":               "",
+		"logs/.hidden.log":            "",
+		"src/.idea/workspace.xml":     "Name {.git,.idea}",
+	} {
+		ignored, _ := MatchSyncIgnoreRules(rules, name)
+		if (ignored == nil && rule != "") || (ignored != nil && ignored.Rule != rule) {
+			t.Errorf("expected %s to be ignored by '%s', got %+v", name, rule, ignored)
+		}
+	}
+	if _, kept := MatchSyncIgnoreRules(rules, "logs/keep.log"); kept == nil || kept.Rule != "Name keep.log" {
+		t.Errorf("expected logs/keep.log to be kept by an exception, got %+v", kept)
+	}
+
+	// Wildcards of ignore files match a leading dot and the last match wins.
+	rules, err = ReadIgnorePatterns(strings.NewReader("*.log\n!keep.log\nbuild/\n"), ".gitignore", false)
+	if err != nil || CheckIgnoreRuleOrder(rules) != nil {
+		t.Fatalf("expected the patterns to be accepted: %v %v", err, CheckIgnoreRuleOrder(rules))
+	}
+	for name, rule := range map[string]string{
+		"logs/.hidden.log": `Regex (.*/)?[^/]*\.log`,
+		"keep.log":         "",
+		"build/keep.log":   "Name build",
+	} {
+		ignored, _ := MatchSyncIgnoreRules(rules, name)
+		if (ignored == nil && rule != "") || (ignored != nil && ignored.Rule != rule) {
+			t.Errorf("expected %s to be ignored by '%s', got %+v", name, rule, ignored)
+		}
+	}
+
+	// Rules after an exception which may ignore the same paths are refused.
+	for content, refused := range map[string]bool{
+		"!important.log\n*.log\n":   true,
+		"!keep-*.log\nkeep-?.log\n": true,
+		"!keep/\nbuild/\n":          false,
+		"!keep-*.log\n*.tmp\n":      false,
+		"!keep.log\n!*.log\n":       false,
+	} {
+		rules, err = ReadIgnorePatterns(strings.NewReader(content), ".gitignore", false)
+		if err = CheckIgnoreRuleOrder(rules); (err != nil) != refused {
+			t.Errorf("expected the patterns %q to be refused: %v, found: %v", content, refused, err)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/phase2/rig/util"
+)
+
+// RsyncWatchSyncDriver keeps the volume up to date with the project directory
+// one way, from a container which repeatedly rsyncs the directory mounted
+// read-only into the volume. Changes made in the volume are overwritten,
+// except for ignored paths which are left alone.
+type RsyncWatchSyncDriver struct {
+	cmd *ProjectSync
+}
+
+const (
+	// rsyncImage is the image running rsync for the copy and rsync-watch
+	// drivers, which has it installed.
+	rsyncImage = "instrumentisto/rsync-ssh"
+	// rsyncWatchMarker is touched in the container after each completed sync.
+	rsyncWatchMarker = "/tmp/rig-rsync-synced"
+	// rsyncWatchInterval is the time between the syncs without an interval
+	// sync setting. Each sync compares the whole directory, so large projects
+	// may want a longer one.
+	rsyncWatchInterval = time.Second
+)
+
+// Name identifies the driver in the sync settings.
+func (d *RsyncWatchSyncDriver) Name() string {
+	return "rsync-watch"
+}
+
+// Start creates the volume and starts the sync container, waiting for the
+// first sync to finish.
+func (d *RsyncWatchSyncDriver) Start(target *SyncTarget) error {
+	cmd, volumeName := d.cmd, target.Volume
+	cmd.out.SpinWithVerbose("Creating sync volume: %s", volumeName)
+	if err := util.Command("docker", "volume", "create", volumeName).Run(); err != nil {
+		return cmd.Failure(fmt.Sprintf("Failed to create sync volume: %s", volumeName), "VOLUME-CREATE-FAILED", 13)
+	}
+
+	filters, err := cmd.RsyncFilters(target)
+	if err != nil {
+		return cmd.Failure(err.Error(), "SYNC-IGNORE-FAILED", 12)
+	}
+	interval := rsyncWatchInterval
+	if target.Mapping != nil && target.Mapping.Interval != "" {
+		if interval, err = time.ParseDuration(target.Mapping.Interval); err != nil || interval <= 0 {
+			return cmd.Failure(fmt.Sprintf("Invalid sync interval '%s', expected a duration such as 5s", target.Mapping.Interval), "SYNC-INTERVAL-INVALID", 12)
+		}
+	}
+
+	cmd.out.SpinWithVerbose("Starting sync container: %s (same name)", volumeName)
+	util.Command("docker", "container", "stop", volumeName).Run() // nolint: gosec
+	// The filters are passed as arguments of the loop, which hands them on
+	// to rsync, so they need no quoting.
+	loop := fmt.Sprintf(`while :; do rsync -a --delete "$@" /source/ /sync/ && touch %s; sleep %s; done`, rsyncWatchMarker, strconv.FormatFloat(interval.Seconds(), 'f', -1, 64))
+	containerArgs := []string{
+		"container", "run", "--detach", "--rm",
+		"-v", fmt.Sprintf("%s:/source:ro", target.Dir),
+		"-v", fmt.Sprintf("%s:/sync", volumeName),
+		"--name", volumeName,
+		"--entrypoint", "sh",
+		rsyncImage,
+		"-c", loop, "sh",
+	}
+	containerArgs = append(containerArgs, filters...)
+	if output, err := util.Command("docker", containerArgs...).CombinedOutput(); err != nil {
+		return cmd.Failure(fmt.Sprintf("Failure starting sync container %s: %v %s", volumeName, err, strings.TrimSpace(string(output))), "SYNC-CONTAINER-START-FAILED", 13)
+	}
+
+	cmd.out.SpinWithVerbose("Waiting for initial sync...")
+	for i := 0; i < target.Timeout; i++ {
+		if _, err := rsyncWatchLastSync(volumeName); err == nil {
+			cmd.out.Info("Watch rsync activities with: docker container logs %s", volumeName)
+			return cmd.Success(fmt.Sprintf("Rsync sync to volume '%s' started", volumeName))
+		}
+		if !util.ContainerRunning(volumeName) {
+			return cmd.Failure(fmt.Sprintf("Sync container %s exited before the initial sync. Run 'rig project sync:start --verbose' to see the docker command", volumeName), "RSYNC-SYNC-FAILED", 13)
+		}
+		time.Sleep(time.Second)
+	}
+
+	return cmd.Failure(fmt.Sprintf("Initial sync to volume %s did not finish within %d seconds. Check its progress with: docker container logs %s", volumeName, target.Timeout, volumeName), "RSYNC-SYNC-FAILED", 13)
+}
+
+// Stop stops the sync container, leaving the volume as last synced.
+func (d *RsyncWatchSyncDriver) Stop(target *SyncTarget) error {
+	cmd, volumeName := d.cmd, target.Volume
+	cmd.out.Spin(fmt.Sprintf("Stopping sync container (%s)", volumeName))
+	if err := util.Command("docker", "container", "stop", volumeName).Run(); err != nil {
+		return cmd.Failure(err.Error(), "SYNC-CONTAINER-FAILURE", 13)
+	}
+
+	return cmd.Success(fmt.Sprintf("Sync container '%s' stopped", volumeName))
+}
+
+// Check checks the sync container is running and has completed a sync.
+func (d *RsyncWatchSyncDriver) Check(target *SyncTarget) error {
+	cmd, volumeName := d.cmd, target.Volume
+	cmd.out.Spin("Checking for sync container...")
+	if running := util.ContainerRunning(volumeName); !running {
+		return cmd.Failure(fmt.Sprintf("Sync container (%s) is not running. Run 'rig project sync:start' to start it", volumeName), "SYNC-CHECK-FAILED", 13)
+	}
+	lastSync, err := rsyncWatchLastSync(volumeName)
+	if err != nil {
+		return cmd.Failure(fmt.Sprintf("Sync container (%s) has not completed a sync. Check its output with: docker container logs %s", volumeName, volumeName), "SYNC-CHECK-FAILED", 13)
+	}
+
+	cmd.out.Info("Sync container (%s) last synced %s at %s", volumeName, target.Dir, lastSync.Format(time.RFC3339))
+	return nil
+}
+
+// Status reports on the sync container and the time of its last sync.
+func (d *RsyncWatchSyncDriver) Status(target *SyncTarget) (*SyncStatus, error) {
+	status := newSyncStatus(d, target)
+	container := util.ContainerRunning(target.Volume)
+	status.Container = &container
+	if container {
+		if lastSync, err := rsyncWatchLastSync(target.Volume); err == nil {
+			status.LastSync = &lastSync
+		}
+	}
+
+	return status, nil
+}
+
+// Purge stops the sync container and removes the volume.
+func (d *RsyncWatchSyncDriver) Purge(target *SyncTarget) error {
+	cmd, volumeName := d.cmd, target.Volume
+	cmd.out.Spin("Checking for sync container...")
+	if running := util.ContainerRunning(volumeName); running {
+		cmd.out.Spin(fmt.Sprintf("Stopping sync container (%s)", volumeName))
+		if err := util.Command("docker", "container", "stop", volumeName).Run(); err != nil {
+			cmd.out.Warn("Could not stop sync container (%s): Maybe it's already stopped?", volumeName)
+		} else {
+			cmd.out.Info("Stopped sync container (%s)", volumeName)
+		}
+	} else {
+		cmd.out.Info("No running sync container.")
+	}
+
+	return cmd.removeSyncVolume(volumeName)
+}
+
+// RsyncFilters translates the ignore rules of a sync target into rsync
+// options. Exceptions come first, as rsync applies the first rule matching a
+// path while unison keeps whatever an exception matches.
+func (cmd *ProjectSync) RsyncFilters(target *SyncTarget) ([]string, error) {
+	rules, err := cmd.SyncIgnoreRules(target)
+	if err != nil {
+		return nil, err
+	}
+
+	includes, excludes := []string{}, []string{}
+	for _, rule := range rules {
+		pattern, err := rule.RsyncPattern()
+		if err != nil {
+			return nil, err
+		}
+		if rule.Not {
+			includes = append(includes, "--include="+pattern)
+		} else {
+			excludes = append(excludes, "--exclude="+pattern)
+		}
+	}
+
+	return append(includes, excludes...), nil
+}
+
+// RsyncPattern is the rsync pattern matching the paths the rule ignores. Rules
+// read from ignore files keep their pattern, which rsync understands, while
+// name and path rules are translated. Regex rules and unison brace patterns
+// have no rsync equivalent.
+func (r *SyncIgnoreRule) RsyncPattern() (string, error) {
+	if r.pattern != "" {
+		return r.pattern, nil
+	}
+
+	parts := strings.SplitN(r.Rule, " ", 2)
+	if len(parts) == 2 && !strings.ContainsAny(parts[1], "{}") {
+		switch parts[0] {
+		case "Name":
+			return parts[1], nil
+		case "Path", "BelowPath":
+			return "/" + strings.TrimPrefix(parts[1], "/"), nil
+		}
+	}
+
+	return "", fmt.Errorf("'%s' from %s can not be applied by rsync. Use a name or path rule, or a pattern in an ignore_from file", r.Rule, r.Source)
+}
+
+// rsyncWatchLastSync reads the time the sync container last completed a sync.
+func rsyncWatchLastSync(container string) (time.Time, error) {
+	output, err := util.Command("docker", "container", "exec", container, "stat", "-c", "%Y", rsyncWatchMarker).Output()
+	if err != nil {
+		return time.Time{}, err
+	}
+	seconds, err := strconv.ParseInt(strings.TrimSpace(string(output)), 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(seconds, 0), nil
+}
@@ -0,0 +1,303 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/phase2/rig/util"
+	"github.com/urfave/cli"
+)
+
+// States of a supervised unison process.
+const (
+	supervisorRunning    = "running"
+	supervisorRestarting = "restarting"
+	supervisorStopped    = "stopped"
+	supervisorFailed     = "failed"
+)
+
+const (
+	// syncRestartBackoff is the wait before the first restart of unison, which
+	// doubles with each quick failure up to syncRestartMaxBackoff.
+	syncRestartBackoff    = time.Second
+	syncRestartMaxBackoff = time.Minute
+	// syncStableRun is how long unison must run for its next failure to be
+	// treated as the first.
+	syncStableRun = time.Minute
+	// syncMaxFailures is the number of quick failures in a row after which
+	// the supervisor gives up.
+	syncMaxFailures = 10
+	// syncStopTimeout bounds the wait for a process asked to exit.
+	syncStopTimeout = 10 * time.Second
+)
+
+// SyncSupervisorState is kept in the rig state directory for each volume
+// synced by a supervised unison process.
+type SyncSupervisorState struct {
+	Volume        string    `json:"volume"`
+	Dir           string    `json:"dir"`
+	SupervisorPID int       `json:"supervisor_pid"`
+	PID           int       `json:"pid"`
+	State         string    `json:"state"`
+	Restarts      int       `json:"restarts"`
+	LastExit      string    `json:"last_exit,omitempty"`
+	Updated       time.Time `json:"updated"`
+}
+
+// syncSupervisorStateFile is the state file of the supervisor for a volume.
+func syncSupervisorStateFile(volume string) (string, error) {
+	dir, err := util.StateDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "sync", volume+".json"), nil
+}
+
+// LoadSyncSupervisorState reads the state of the supervisor for a volume, or
+// nil if it has none.
+func LoadSyncSupervisorState(volume string) (*SyncSupervisorState, error) {
+	file, err := syncSupervisorStateFile(volume)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Could not read sync state: %s", err)
+	}
+	state := &SyncSupervisorState{}
+	if err := json.Unmarshal(content, state); err != nil {
+		return nil, fmt.Errorf("Could not read sync state from %s: %s", file, err)
+	}
+
+	return state, nil
+}
+
+// save writes the state of the supervisor.
+func (s *SyncSupervisorState) save() error {
+	file, err := syncSupervisorStateFile(s.Volume)
+	if err != nil {
+		return err
+	}
+
+	s.Updated = time.Now()
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return fmt.Errorf("Could not create the sync state directory: %s", err)
+	}
+	if err := ioutil.WriteFile(file, content, 0600); err != nil {
+		return fmt.Errorf("Could not save sync state: %s", err)
+	}
+
+	return nil
+}
+
+// superviseCommand is the hidden command run in the background by
+// sync:start to keep unison running.
+func (cmd *ProjectSync) superviseCommand() cli.Command {
+	return cli.Command{
+		Name:        "sync:supervise",
+		Category:    "File Sync",
+		Usage:       "Run unison, restarting it whenever it exits.",
+		Description: "Started in the background by sync:start with the arguments for unison, recording its state for sync:status, sync:stop and sync:purge.",
+		ArgsUsage:   "-- <unison arguments>",
+		Hidden:      true,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "volume",
+				Usage: "The sync volume, naming the state file.",
+			},
+			cli.StringFlag{
+				Name:  "dir",
+				Usage: "The directory to run unison in.",
+			},
+		},
+		Before: cmd.Before,
+		Action: cmd.RunSupervise,
+	}
+}
+
+// RunSupervise executes the `rig project sync:supervise` command, running
+// unison until told to stop. Whenever unison exits it is restarted, waiting
+// longer after each quick failure.
+func (cmd *ProjectSync) RunSupervise(ctx *cli.Context) error {
+	state := &SyncSupervisorState{
+		Volume:        ctx.String("volume"),
+		Dir:           ctx.String("dir"),
+		SupervisorPID: os.Getpid(),
+	}
+	if state.Volume == "" || len(ctx.Args()) == 0 {
+		return cmd.Failure("The sync volume and unison arguments are required", "COMMAND-ERROR", 12)
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	backoff, failures := syncRestartBackoff, 0
+	for {
+		started := time.Now()
+		/* #nosec */
+		unison := exec.Command("unison", ctx.Args()...)
+		unison.Dir = state.Dir
+		if err := unison.Start(); err != nil {
+			state.LastExit = err.Error()
+		} else {
+			state.PID, state.State = unison.Process.Pid, supervisorRunning
+			if err := state.save(); err != nil {
+				cmd.out.Error("%s", err)
+			}
+
+			done := make(chan error, 1)
+			go func() { done <- unison.Wait() }()
+			select {
+			case <-stop:
+				if err := util.TerminateProcess(unison.Process.Pid); err != nil {
+					unison.Process.Kill() // nolint: gosec
+				}
+				select {
+				case <-done:
+				case <-time.After(syncStopTimeout):
+					unison.Process.Kill() // nolint: gosec
+					<-done
+				}
+				state.PID, state.State = 0, supervisorStopped
+				return state.save()
+			case err := <-done:
+				state.LastExit = "unison exited"
+				if err != nil {
+					state.LastExit = fmt.Sprintf("unison exited: %s", err)
+				}
+			}
+		}
+
+		if time.Since(started) >= syncStableRun {
+			backoff, failures = syncRestartBackoff, 0
+		}
+		failures++
+		state.PID = 0
+		if failures > syncMaxFailures {
+			state.State = supervisorFailed
+			state.save() // nolint: gosec
+			return cmd.Failure(fmt.Sprintf("Unison failed %d times in a row: %s", failures, state.LastExit), "UNISON-SYNC-FAILED", 13)
+		}
+
+		state.Restarts++
+		state.State = supervisorRestarting
+		if err := state.save(); err != nil {
+			cmd.out.Error("%s", err)
+		}
+		select {
+		case <-stop:
+			state.State = supervisorStopped
+			return state.save()
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > syncRestartMaxBackoff {
+			backoff = syncRestartMaxBackoff
+		}
+	}
+}
+
+// startSyncSupervisor runs sync:supervise in the background with the
+// arguments for unison, replacing any supervisor already running for the
+// volume.
+func (cmd *ProjectSync) startSyncSupervisor(target *SyncTarget, unisonArgs []string) error {
+	if _, err := cmd.stopSyncSupervisor(target.Volume); err != nil {
+		return err
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	args := append([]string{"project", "sync:supervise", "--volume", target.Volume, "--dir", target.Dir, "--"}, unisonArgs...)
+	/* #nosec */
+	command := exec.Command(executable, args...)
+	command.Dir = target.Dir
+	util.DetachProcess(command)
+	if err := util.Convert(command).Start(); err != nil {
+		return err
+	}
+	cmd.out.Verbose("Supervising unison with process %d", command.Process.Pid)
+
+	return command.Process.Release()
+}
+
+// stopSyncSupervisor stops the supervisor of a volume and its unison process,
+// reporting whether either was running. Each process is only stopped while its
+// command line shows it is still part of the sync of the volume. Otherwise its
+// id was reused after it exited, so the state is stale and removed once the
+// other process is dealt with.
+func (cmd *ProjectSync) stopSyncSupervisor(volume string) (bool, error) {
+	state, err := LoadSyncSupervisorState(volume)
+	if err != nil || state == nil {
+		return false, err
+	}
+
+	stopped, stale := false, false
+	processes := []struct {
+		pid     int
+		matches func(string) bool
+	}{
+		{state.SupervisorPID, func(line string) bool {
+			return strings.Contains(line, "sync:supervise") && strings.Contains(line+" ", " --volume "+volume+" ")
+		}},
+		{state.PID, func(line string) bool {
+			return strings.Contains(line, "unison")
+		}},
+	}
+	for _, process := range processes {
+		pid := process.pid
+		if !util.ProcessRunning(pid) {
+			continue
+		}
+		if line, err := util.ProcessCommandLine(pid); err != nil || !process.matches(line) {
+			cmd.out.Verbose("Process %d is no longer part of the sync of %s, leaving it running", pid, volume)
+			stale = true
+			continue
+		}
+
+		stopped = true
+		cmd.out.Verbose("Stopping process %d", pid)
+		if err := util.TerminateProcess(pid); err != nil {
+			return stopped, fmt.Errorf("Could not stop process %d: %s", pid, err)
+		}
+		for deadline := time.Now().Add(syncStopTimeout); util.ProcessRunning(pid) && time.Now().Before(deadline); {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+
+	if stale {
+		cmd.out.Verbose("Removing the stale supervisor state of %s", volume)
+		return stopped, removeSyncSupervisorState(volume)
+	}
+	state.SupervisorPID, state.PID, state.State = 0, 0, supervisorStopped
+	return stopped, state.save()
+}
+
+// removeSyncSupervisorState forgets the supervisor of a volume.
+func removeSyncSupervisorState(volume string) error {
+	file, err := syncSupervisorStateFile(volume)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,182 @@
+package commands
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phase2/rig/util"
+	"github.com/urfave/cli"
+)
+
+// startTestProcess starts a process which keeps running until it is stopped,
+// with the arguments in its command line, reaping it once it exits. It waits
+// for the command line to show, as the process is briefly a copy of this one.
+func startTestProcess(t *testing.T, args ...string) (*exec.Cmd, <-chan struct{}) {
+	process := exec.Command("sh", append([]string{"-c", "sleep 30; :"}, args...)...)
+	if err := process.Start(); err != nil {
+		t.Fatal(err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		process.Wait() // nolint: gosec
+		close(exited)
+	}()
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if line, err := util.ProcessCommandLine(process.Process.Pid); err == nil && strings.Contains(line, "sleep 30") {
+			return process, exited
+		}
+	}
+	process.Process.Kill() // nolint: gosec
+	t.Fatal("expected the test process to start")
+	return nil, nil
+}
+
+func TestStopSyncSupervisor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rig-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("RIG_STATE_DIR", dir)
+	defer os.Unsetenv("RIG_STATE_DIR")
+	cmd := &ProjectSync{BaseCommand: BaseCommand{out: util.Logger()}}
+
+	// The recorded processes exited and their ids now belong to others.
+	other, exited := startTestProcess(t, "other")
+	defer other.Process.Kill() // nolint: gosec
+	stale := &SyncSupervisorState{Volume: "test-sync", SupervisorPID: other.Process.Pid, PID: other.Process.Pid, State: supervisorRunning}
+	if err = stale.save(); err != nil {
+		t.Fatal(err)
+	}
+	if stopped, err := cmd.stopSyncSupervisor("test-sync"); err != nil || stopped {
+		t.Errorf("expected nothing to be stopped for stale state, found %v (%v)", stopped, err)
+	}
+	select {
+	case <-exited:
+		t.Error("expected the process reusing the recorded id to keep running")
+	case <-time.After(200 * time.Millisecond):
+	}
+	if state, err := LoadSyncSupervisorState("test-sync"); err != nil || state != nil {
+		t.Errorf("expected the stale state to be removed, found %v (%v)", state, err)
+	}
+
+	// Unison outliving its supervisor is stopped before the state is removed.
+	unison, unisonExited := startTestProcess(t, "unison", "-repeat", "watch")
+	defer unison.Process.Kill() // nolint: gosec
+	stale.PID = unison.Process.Pid
+	if err = stale.save(); err != nil {
+		t.Fatal(err)
+	}
+	if stopped, err := cmd.stopSyncSupervisor("test-sync"); err != nil || !stopped {
+		t.Errorf("expected unison to be stopped, found %v (%v)", stopped, err)
+	}
+	select {
+	case <-unisonExited:
+	case <-time.After(5 * time.Second):
+		t.Error("expected unison to exit")
+	}
+	select {
+	case <-exited:
+		t.Error("expected the process reusing the supervisor id to keep running")
+	default:
+	}
+	if state, err := LoadSyncSupervisorState("test-sync"); err != nil || state != nil {
+		t.Errorf("expected the stale state to be removed, found %v (%v)", state, err)
+	}
+
+	// A supervisor of another volume is left alone too.
+	supervisor, exited := startTestProcess(t, "project", "sync:supervise", "--volume", "test-sync", "--")
+	defer supervisor.Process.Kill() // nolint: gosec
+	stale.SupervisorPID, stale.PID = supervisor.Process.Pid, 0
+	stale.Volume = "test"
+	if err = stale.save(); err != nil {
+		t.Fatal(err)
+	}
+	if stopped, err := cmd.stopSyncSupervisor("test"); err != nil || stopped {
+		t.Errorf("expected the supervisor of another volume to be left alone, found %v (%v)", stopped, err)
+	}
+
+	stale.Volume = "test-sync"
+	if err = stale.save(); err != nil {
+		t.Fatal(err)
+	}
+	if stopped, err := cmd.stopSyncSupervisor("test-sync"); err != nil || !stopped {
+		t.Errorf("expected the supervisor to be stopped, found %v (%v)", stopped, err)
+	}
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Error("expected the supervisor to exit")
+	}
+	if state, err := LoadSyncSupervisorState("test-sync"); err != nil || state == nil || state.State != supervisorStopped || state.SupervisorPID != 0 {
+		t.Errorf("expected the state to record the stopped supervisor, found %v (%v)", state, err)
+	}
+}
+
+func TestRunSuperviseRestartsUnison(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rig-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("RIG_STATE_DIR", dir)
+	defer os.Unsetenv("RIG_STATE_DIR")
+
+	// The first unison fails quickly and the restarted one keeps running.
+	unison := "#!/bin/sh\necho run >> runs.log\n[ $(wc -l < runs.log) -ge 2 ] && exec sleep 30\nexit 3\n"
+	if err = ioutil.WriteFile(filepath.Join(dir, "unison"), []byte(unison), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	defer os.Setenv("PATH", path)
+
+	flags := flag.NewFlagSet("sync:supervise", flag.ContinueOnError)
+	flags.String("volume", "", "")
+	flags.String("dir", "", "")
+	if err = flags.Parse([]string{"--volume", "test-sync", "--dir", dir, "--", "."}); err != nil {
+		t.Fatal(err)
+	}
+	cmd := &ProjectSync{BaseCommand: BaseCommand{out: util.Logger()}}
+	supervised := make(chan error, 1)
+	go func() { supervised <- cmd.RunSupervise(cli.NewContext(nil, flags, nil)) }()
+
+	var state *SyncSupervisorState
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(100 * time.Millisecond) {
+		if state, err = LoadSyncSupervisorState("test-sync"); err == nil && state != nil && state.Restarts == 1 && state.State == supervisorRunning {
+			break
+		}
+	}
+	if state == nil || state.Restarts != 1 || state.State != supervisorRunning || !strings.Contains(state.LastExit, "exit status 3") {
+		t.Fatalf("expected unison to be restarted after it failed, found %+v (%v)", state, err)
+	}
+	if !util.ProcessRunning(state.PID) {
+		t.Errorf("expected the restarted unison %d to be running", state.PID)
+	}
+
+	// sync:stop asks the supervisor to exit, stopping unison along with it.
+	if err = util.TerminateProcess(os.Getpid()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err = <-supervised:
+		if err != nil {
+			t.Errorf("expected the supervisor to stop cleanly, found %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the supervisor to stop")
+	}
+	if util.ProcessRunning(state.PID) {
+		t.Errorf("expected unison %d to be stopped", state.PID)
+	}
+	if state, err = LoadSyncSupervisorState("test-sync"); err != nil || state == nil || state.State != supervisorStopped || state.PID != 0 {
+		t.Errorf("expected the state to record the stopped supervisor, found %+v (%v)", state, err)
+	}
+}
@@ -0,0 +1,338 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/phase2/rig/util"
+)
+
+// UnisonSyncDriver syncs the project directory both ways with a unison
+// container writing to the volume, for Docker running in a virtual machine.
+type UnisonSyncDriver struct {
+	cmd *ProjectSync
+}
+
+// Name identifies the driver in the sync settings.
+func (d *UnisonSyncDriver) Name() string {
+	return "unison"
+}
+
+// Start will create and launch the volumes and containers on systems that need/support Unison
+func (d *UnisonSyncDriver) Start(target *SyncTarget) error {
+	cmd, volumeName, workingDir := d.cmd, target.Volume, target.Dir
+	cmd.out.Spin("Starting Outrigger Filesync (unison)...")
+
+	ignores, err := cmd.SyncIgnoreRules(target)
+	if err != nil {
+		return cmd.Failure(err.Error(), "SYNC-IGNORE-FAILED", 12)
+	}
+
+	// Ensure the processes can handle a large number of watches
+	if !util.SupportsNativeDocker() {
+		if err := cmd.machine.SetSysctl("fs.inotify.max_user_watches", maxWatches); err != nil {
+			cmd.Failure(fmt.Sprintf("Failure configuring file watches on Docker Machine: %v", err), "INOTIFY-WATCH-FAILURE", 12) // nolint: gosec
+		}
+	}
+
+	cmd.out.SpinWithVerbose("Starting sync volume: %s", volumeName)
+	if err := util.Command("docker", "volume", "create", volumeName).Run(); err != nil {
+		return cmd.Failure(fmt.Sprintf("Failed to create sync volume: %s", volumeName), "VOLUME-CREATE-FAILED", 13)
+	}
+	cmd.out.Info("Sync volume '%s' created", volumeName)
+	cmd.out.SpinWithVerbose(fmt.Sprintf("Starting sync container: %s (same name)", volumeName))
+	unisonMinorVersion := util.GetUnisonMinorVersion()
+
+	cmd.out.Verbose("Local Unison version for compatibility: %s", unisonMinorVersion)
+	util.Command("docker", "container", "stop", volumeName).Run() // nolint: gosec
+	containerArgs := []string{
+		"container", "run", "--detach", "--rm",
+		"-v", fmt.Sprintf("%s:/unison", volumeName),
+		"-e", "UNISON_DIR=/unison",
+		"-l", fmt.Sprintf("com.dnsdock.name=%s", volumeName),
+		"-l", "com.dnsdock.image=volume.outrigger",
+		"--name", volumeName,
+		fmt.Sprintf("outrigger/unison:%s", unisonMinorVersion),
+	}
+	if err := util.Command("docker", containerArgs...).Run(); err != nil {
+		cmd.Failure(fmt.Sprintf("Failure starting sync container %s: %v", volumeName, err), "SYNC-CONTAINER-START-FAILED", 13) // nolint: gosec
+	}
+
+	ip, err := cmd.WaitForUnisonContainer(volumeName, target.Timeout)
+	if err != nil {
+		return cmd.Failure(err.Error(), "SYNC-INIT-FAILED", 13)
+	}
+	cmd.out.Info("Sync container '%s' started", volumeName)
+	cmd.out.SpinWithVerbose("Initializing file sync...")
+
+	// Determine the location of the local Unison log file.
+	var logFile = cmd.LogFileName(volumeName)
+	// Remove the log file, the existence of the log file will mean that sync is
+	// up and running. If the logfile does not exist, do not complain. If the
+	// filesystem cannot delete the file when it exists, it will lead to errors.
+	if removeErr := util.RemoveFile(logFile, workingDir); removeErr != nil {
+		cmd.out.Verbose("Could not remove Unison log file: %s: %s", logFile, removeErr.Error())
+	}
+
+	// Initiate local Unison process.
+	unisonArgs := []string{
+		".",
+		fmt.Sprintf("socket://%s:%d/", ip, unisonPort),
+		"-auto", "-batch", "-silent", "-contactquietly",
+		"-repeat", "watch",
+		"-prefer", ".",
+		"-logfile", logFile,
+	}
+	// Append the sync log, ProjectConfig and ignore file rules here
+	for _, rule := range ignores {
+		unisonArgs = append(unisonArgs, rule.Flag(), rule.Rule)
+	}
+
+	// Run unison under a supervisor which restarts it should it exit.
+	cmd.out.Verbose("Sync execution - Working Directory: %s", workingDir)
+	if err = cmd.startSyncSupervisor(target, unisonArgs); err != nil {
+		return cmd.Failure(fmt.Sprintf("Failure starting local Unison process: %v", err), "UNISON-START-FAILED", 13)
+	}
+
+	if err := cmd.WaitForSyncInit(logFile, workingDir, target.Timeout, target.Wait); err != nil {
+		return cmd.Failure(err.Error(), "UNISON-SYNC-FAILED", 13)
+	}
+
+	cmd.out.Info("Watch unison process activities in the sync log: %s", logFile)
+
+	return cmd.Success("Unison sync started successfully")
+}
+
+// Stop shuts down the local unison process and the unison container.
+func (d *UnisonSyncDriver) Stop(target *SyncTarget) error {
+	cmd, volumeName := d.cmd, target.Volume
+	cmd.out.Spin("Stopping local Unison process")
+	if stopped, err := cmd.stopSyncSupervisor(volumeName); err != nil {
+		return cmd.Failure(err.Error(), "UNISON-STOP-FAILED", 12)
+	} else if stopped {
+		cmd.out.Info("Stopped local Unison process")
+	} else {
+		cmd.out.Info("No local Unison process running")
+	}
+
+	cmd.out.Spin(fmt.Sprintf("Stopping Unison container (%s)", volumeName))
+	if err := util.Command("docker", "container", "stop", volumeName).Run(); err != nil {
+		return cmd.Failure(err.Error(), "SYNC-CONTAINER-FAILURE", 13)
+	}
+
+	return cmd.Success(fmt.Sprintf("Unison container '%s' stopped", volumeName))
+}
+
+// Check checks the unison container is listening and a file change syncs.
+func (d *UnisonSyncDriver) Check(target *SyncTarget) error {
+	cmd, volumeName := d.cmd, target.Volume
+	cmd.out.Info("Ready to begin unison test")
+	cmd.out.Spin("Checking for unison container...")
+	if running := util.ContainerRunning(volumeName); !running {
+		return cmd.Failure(fmt.Sprintf("Unison container (%s) is not running", volumeName), "SYNC-CHECK-FAILED", 13)
+	}
+	cmd.out.Info("Unison container found: %s", volumeName)
+	cmd.out.Spin("Check unison container process is listening...")
+	if _, err := cmd.WaitForUnisonContainer(volumeName, target.Timeout); err != nil {
+		cmd.out.Error("Unison process not listening")
+		return cmd.Failure(err.Error(), "SYNC-CHECK-FAILED", 13)
+	}
+	cmd.out.Info("Unison process is listening")
+
+	// Determine if sync progress can be tracked.
+	cmd.out.Info("Preparing live file sync test")
+	var logFile = cmd.LogFileName(volumeName)
+	if err := cmd.WaitForSyncInit(logFile, target.Dir, target.Timeout, target.Wait); err != nil {
+		return cmd.Failure(err.Error(), "UNISON-SYNC-FAILED", 13)
+	}
+
+	return nil
+}
+
+// Purge removes the local unison process, unison container, volume, log and state files.
+func (d *UnisonSyncDriver) Purge(target *SyncTarget) error {
+	cmd, volumeName, workingDir := d.cmd, target.Volume, target.Dir
+	cmd.out.Spin("Stopping local Unison process")
+	if stopped, err := cmd.stopSyncSupervisor(volumeName); err != nil {
+		cmd.out.Warning("Could not stop local Unison process: %s", err)
+	} else if stopped {
+		cmd.out.Info("Stopped local Unison process")
+	}
+	if err := removeSyncSupervisorState(volumeName); err != nil {
+		cmd.out.Warning("Could not remove sync state: %s", err)
+	}
+
+	cmd.out.Spin("Checking for unison container...")
+	if running := util.ContainerRunning(volumeName); running {
+		cmd.out.Spin(fmt.Sprintf("Stopping Unison container (%s)", volumeName))
+		if stopErr := util.Command("docker", "container", "stop", volumeName).Run(); stopErr != nil {
+			cmd.out.Warn("Could not stop unison container (%s): Maybe it's already stopped?", volumeName)
+		} else {
+			cmd.out.Info("Stopped unison container (%s)", volumeName)
+		}
+	} else {
+		cmd.out.Info("No running unison container.")
+	}
+
+	logFile := cmd.LogFileName(volumeName)
+	cmd.out.Spin(fmt.Sprintf("Removing unison log file: %s", logFile))
+	if util.FileExists(logFile, workingDir) {
+		if removeErr := util.RemoveFile(logFile, workingDir); removeErr != nil {
+			cmd.out.Error("Could not remove unison log file: %s: %s", logFile, removeErr.Error())
+		} else {
+			cmd.out.Info("Removed unison log file: %s", logFile)
+		}
+	} else {
+		cmd.out.Info("Log file does not exist")
+	}
+
+	// Remove sync fragment files.
+	cmd.out.Spin("Removing .unison directories")
+	if removeGlobErr := util.RemoveFileGlob("*.unison*", workingDir, cmd.out); removeGlobErr != nil {
+		cmd.out.Warning("Could not remove .unison directories: %s", removeGlobErr)
+	} else {
+		cmd.out.Info("Removed all .unison directories")
+	}
+
+	return cmd.removeSyncVolume(volumeName)
+}
+
+// Status reports on the unison container and local process, and summarizes
+// the sync log.
+func (d *UnisonSyncDriver) Status(target *SyncTarget) (*SyncStatus, error) {
+	cmd := d.cmd
+	status := newSyncStatus(d, target)
+	container := util.ContainerRunning(target.Volume)
+	status.Container = &container
+
+	// Unison started by sync:start is supervised, otherwise look for it.
+	logFile := cmd.LogFileName(target.Volume)
+	if state, err := LoadSyncSupervisorState(target.Volume); err != nil {
+		return nil, err
+	} else if state != nil && state.SupervisorPID != 0 {
+		process := util.ProcessRunning(state.PID)
+		status.Process = &process
+		status.Supervisor, status.Restarts, status.LastExit = state.State, state.Restarts, state.LastExit
+		if !util.ProcessRunning(state.SupervisorPID) {
+			status.Supervisor = "not running"
+		}
+	} else if process, err := unisonProcessRunning(logFile); err == nil {
+		status.Process = &process
+	} else {
+		cmd.out.Verbose("Could not look for the local unison process: %s", err)
+	}
+
+	path := filepath.Join(target.Dir, logFile)
+	file, err := os.Open(path) // nolint: gosec
+	if os.IsNotExist(err) {
+		return status, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Could not read the unison log %s: %s", path, err)
+	}
+	defer file.Close() // nolint: errcheck
+
+	modified := time.Now()
+	if info, statErr := file.Stat(); statErr == nil {
+		modified = info.ModTime()
+	}
+	log, err := ParseUnisonLog(file, modified)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read the unison log %s: %s", path, err)
+	}
+
+	status.LogFile = path
+	if !log.LastSync.IsZero() {
+		status.LastSync = &log.LastSync
+	}
+	status.Propagated = log.Propagated
+	status.Conflicts = log.Conflicts
+	status.Errors = log.Errors
+
+	return status, nil
+}
+
+// unisonProcessRunning looks for the local unison process writing to the log
+// file.
+func unisonProcessRunning(logFile string) (bool, error) {
+	if util.IsWindows() {
+		return false, fmt.Errorf("process lookup is not supported on Windows")
+	}
+
+	output, err := util.Command("ps", "-A", "-o", "args=").Output()
+	if err != nil {
+		return false, err
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 && filepath.Base(fields[0]) == "unison" && strings.Contains(line, "-logfile "+logFile) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// unisonLogErrors is the number of recent errors kept from the unison log.
+const unisonLogErrors = 5
+
+var (
+	// unisonPropagating matches the lines unison logs around propagating
+	// changes, which are the only ones to include the date.
+	unisonPropagating = regexp.MustCompile(`propagating changes at (\d+:\d+:\d+)\.\d+ on (\d+ \w+ \d+)`)
+	// unisonSummary matches the summary unison logs after each sync.
+	unisonSummary = regexp.MustCompile(`^Synchronization (complete|incomplete) at (\d+:\d+:\d+)\s+\((\d+) items? transferred, (\d+) skipped, (\d+) failed\)`)
+)
+
+// UnisonLog summarizes the log written by the local unison process.
+type UnisonLog struct {
+	// LastSync is when the last sync without skipped or failed items
+	// finished, or zero if there was none.
+	LastSync time.Time
+	// Propagated counts the items transferred by every sync.
+	Propagated int
+	// Conflicts lists the items skipped by the latest sync, which unison
+	// leaves for the user to resolve.
+	Conflicts []string
+	// Errors lists the most recent errors and failed items.
+	Errors []string
+}
+
+// ParseUnisonLog summarizes a unison log. Summary lines carry only the time,
+// so the date comes from the preceding log lines, or else from when the log
+// was modified.
+func ParseUnisonLog(reader io.Reader, modified time.Time) (*UnisonLog, error) {
+	log := &UnisonLog{Conflicts: []string{}, Errors: []string{}}
+	day := modified.Format("2 Jan 2006")
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if match := unisonPropagating.FindStringSubmatch(line); match != nil {
+			day = match[2]
+		} else if match := unisonSummary.FindStringSubmatch(line); match != nil {
+			transferred, _ := strconv.Atoi(match[3]) // nolint: gosec
+			log.Propagated += transferred
+			log.Conflicts = []string{}
+			if match[1] == "complete" {
+				if finished, err := time.ParseInLocation("2 Jan 2006 15:04:05", day+" "+match[2], time.Local); err == nil {
+					log.LastSync = finished
+				}
+			}
+		} else if strings.HasPrefix(line, "  skipped: ") {
+			log.Conflicts = append(log.Conflicts, strings.TrimPrefix(line, "  skipped: "))
+		} else if strings.HasPrefix(line, "  failed: ") || strings.HasPrefix(line, "Fatal error") || strings.HasPrefix(line, "Error") {
+			log.Errors = append(log.Errors, strings.TrimSpace(line))
+			if len(log.Errors) > unisonLogErrors {
+				log.Errors = log.Errors[1:]
+			}
+		}
+	}
+
+	return log, scanner.Err()
+}
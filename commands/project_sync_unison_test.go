@@ -0,0 +1,38 @@
+package commands
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseUnisonLog(t *testing.T) {
+	content := `Unison 2.51.2 (ocaml 4.08.1) started propagating changes at 09:15:02.31 on 16 Oct 2026
+[BGN] Copying web/index.php from /Users/dev/site to //remote//unison
+[END] Copying web/index.php
+Unison 2.51.2 (ocaml 4.08.1) finished propagating changes at 09:15:02.40 on 16 Oct 2026
+Synchronization complete at 09:15:02  (2 items transferred, 0 skipped, 0 failed)
+Unison 2.51.2 (ocaml 4.08.1) started propagating changes at 10:01:44.02 on 17 Oct 2026
+Synchronization incomplete at 10:01:44  (1 item transferred, 1 skipped, 1 failed)
+  skipped: web/settings.php (contents changed on both sides)
+  failed: web/files/big.sql
+Fatal error: Lost connection with the server
+`
+	log, err := ParseUnisonLog(strings.NewReader(content), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := time.Date(2026, time.October, 16, 9, 15, 2, 0, time.Local); !log.LastSync.Equal(expected) {
+		t.Errorf("expected the last sync at %s, got %s", expected, log.LastSync)
+	}
+	if log.Propagated != 3 {
+		t.Errorf("expected 3 propagated items, got %d", log.Propagated)
+	}
+	if !reflect.DeepEqual(log.Conflicts, []string{"web/settings.php (contents changed on both sides)"}) {
+		t.Errorf("unexpected conflicts: %v", log.Conflicts)
+	}
+	if !reflect.DeepEqual(log.Errors, []string{"failed: web/files/big.sql", "Fatal error: Lost connection with the server"}) {
+		t.Errorf("unexpected errors: %v", log.Errors)
+	}
+}
@@ -0,0 +1,341 @@
+package commands
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/phase2/rig/util"
+	"github.com/urfave/cli"
+)
+
+// ProjectTrust is the command for approving or revoking the project
+// configuration allowed to run scripts
+type ProjectTrust struct {
+	BaseCommand
+	Config *ProjectConfig
+}
+
+// Commands returns the operations supported by this command
+func (cmd *ProjectTrust) Commands() []cli.Command {
+	trust := cli.Command{
+		Name:        "trust",
+		Usage:       "Allow the project configuration to run its scripts.",
+		Description: "Records the current content of the project configuration, including included and local files, as trusted. Scripts and hooks only run from trusted configuration, anything else asks for approval first. Changing any of the files requires approving them again.\n\n\tSet RIG_PROJECT_TRUST=1 to run scripts without approval, such as in CI.",
+		Before:      cmd.Before,
+		Action:      cmd.RunTrust,
+	}
+	untrust := cli.Command{
+		Name:        "untrust",
+		Usage:       "Stop the project configuration from running scripts without approval.",
+		Description: "Removes the project configuration from the trusted configuration kept in the rig state directory, ~/.rig by default or $RIG_STATE_DIR.",
+		Before:      cmd.Before,
+		Action:      cmd.RunUntrust,
+	}
+
+	return []cli.Command{trust, untrust}
+}
+
+// RunTrust executes the `rig project trust` command
+func (cmd *ProjectTrust) RunTrust(ctx *cli.Context) error {
+	if cmd.Config.Path == "" || len(cmd.Config.Files) == 0 {
+		return cmd.Failure("No valid project configuration was found. Run 'rig project validate' for details.", "PROJECT-CONFIG-NOT-FOUND", 12)
+	}
+
+	if err := TrustProjectConfig(cmd.Config); err != nil {
+		return cmd.Failure(err.Error(), "PROJECT-TRUST-ERROR", 12)
+	}
+
+	return cmd.Success(fmt.Sprintf("Trusted project configuration %s", cmd.Config.Path))
+}
+
+// RunUntrust executes the `rig project untrust` command
+func (cmd *ProjectTrust) RunUntrust(ctx *cli.Context) error {
+	if cmd.Config.Path == "" {
+		return cmd.Failure("No valid project configuration was found. Run 'rig project validate' for details.", "PROJECT-CONFIG-NOT-FOUND", 12)
+	}
+
+	removed, err := UntrustProjectConfig(cmd.Config)
+	if err != nil {
+		return cmd.Failure(err.Error(), "PROJECT-TRUST-ERROR", 12)
+	} else if !removed {
+		return cmd.Success(fmt.Sprintf("Project configuration %s was not trusted", cmd.Config.Path))
+	}
+
+	return cmd.Success(fmt.Sprintf("Project configuration %s is no longer trusted", cmd.Config.Path))
+}
+
+// CheckProjectTrust makes sure the scripts of a project configuration may run.
+// Configuration which is new, or has changed since it was trusted, is shown
+// for approval. Without a terminal to ask on this fails, unless
+// RIG_PROJECT_TRUST is set.
+func (cmd *BaseCommand) CheckProjectTrust(config *ProjectConfig) error {
+	if trust := os.Getenv("RIG_PROJECT_TRUST"); trust == "1" || trust == "true" {
+		cmd.out.Verbose("Trusting project configuration %s as set by $RIG_PROJECT_TRUST", config.Path)
+		return nil
+	}
+
+	trusted, err := ProjectConfigTrusted(config)
+	if err != nil {
+		return cmd.Failure(err.Error(), "PROJECT-TRUST-ERROR", 12)
+	} else if trusted {
+		return nil
+	}
+
+	if !util.StdinIsTerminal() {
+		return cmd.Failure(fmt.Sprintf("Project configuration %s is not trusted. Review it and run 'rig project trust', or set RIG_PROJECT_TRUST=1 to run scripts without approval", config.Path), "PROJECT-NOT-TRUSTED", 12)
+	}
+
+	cmd.out.Warning("Project configuration %s is new or has changed since it was trusted", config.Path)
+	cmd.printProjectConfigSummary(config)
+	if !util.AskYesNo("Trust this configuration and run its scripts") {
+		return cmd.Failure(fmt.Sprintf("Project configuration %s was not trusted", config.Path), "PROJECT-NOT-TRUSTED", 12)
+	}
+
+	if err := TrustProjectConfig(config); err != nil {
+		return cmd.Failure(err.Error(), "PROJECT-TRUST-ERROR", 12)
+	}
+	cmd.out.Info("Trusted project configuration %s", config.Path)
+
+	return nil
+}
+
+// printProjectConfigSummary shows the files, scripts and hooks of a project
+// configuration for review.
+func (cmd *BaseCommand) printProjectConfigSummary(config *ProjectConfig) {
+	fmt.Println("Files:")
+	for _, file := range config.Files {
+		fmt.Printf("  %s\n", file)
+	}
+	files, _ := projectTrustFiles(config) // nolint: gosec
+	for _, file := range files {
+		if _, err := os.Stat(file); err == nil {
+			fmt.Printf("  %s\n", file)
+		}
+	}
+
+	ids := []string{}
+	for id := range config.Scripts {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	fmt.Println("Scripts:")
+	for _, id := range ids {
+		fmt.Printf("  %s:\n", id)
+		for _, step := range config.Scripts[id].Steps {
+			fmt.Printf("    - %s\n", step.Run)
+		}
+	}
+
+	if len(config.Hooks) > 0 {
+		fmt.Println("Hooks:")
+		for _, event := range HookEvents {
+			if hook := config.Hooks[event]; hook != nil {
+				if len(hook.Pre) > 0 {
+					fmt.Printf("  pre-%s: %s\n", event, strings.Join(hook.Pre, ", "))
+				}
+				if len(hook.Post) > 0 {
+					fmt.Printf("  post-%s: %s\n", event, strings.Join(hook.Post, ", "))
+				}
+			}
+		}
+	}
+}
+
+// ProjectConfigHash fingerprints the content of every file a project
+// configuration was merged from, along with the env files it loads and the
+// files in its bin directories, which steps run from $PATH. Those files need
+// not exist, so creating one later changes the fingerprint too.
+func ProjectConfigHash(config *ProjectConfig) (string, error) {
+	hash := sha256.New()
+	for _, file := range config.Files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("Could not read project configuration %s: %s", file, err)
+		}
+		if absolute, err := filepath.Abs(file); err == nil {
+			file = absolute
+		}
+		fmt.Fprintf(hash, "%s\x00%d\x00", file, len(content))
+		hash.Write(content) // nolint: gosec
+	}
+
+	files, err := projectTrustFiles(config)
+	if err != nil {
+		return "", err
+	}
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file) // nolint: gosec
+		if os.IsNotExist(err) {
+			fmt.Fprintf(hash, "%s\x00missing\x00", file)
+			continue
+		} else if err != nil {
+			return "", fmt.Errorf("Could not read %s: %s", file, err)
+		}
+		fmt.Fprintf(hash, "%s\x00%d\x00", file, len(content))
+		hash.Write(content) // nolint: gosec
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// projectTrustFiles lists the env files of a project configuration and its
+// scripts, followed by the files in its bin directories, as absolute paths.
+func projectTrustFiles(config *ProjectConfig) ([]string, error) {
+	dir := filepath.Dir(config.Path)
+	resolve := func(file string) string {
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		if absolute, err := filepath.Abs(file); err == nil {
+			file = absolute
+		}
+		return file
+	}
+
+	env := util.NewEnvironment(os.Environ())
+	env.Merge(config.Env)
+	files := []string{}
+	for _, file := range config.EnvFile {
+		files = append(files, resolve(env.Expand(file)))
+	}
+
+	ids := []string{}
+	for id := range config.Scripts {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if script := config.Scripts[id]; script != nil {
+			for _, file := range script.EnvFile {
+				files = append(files, resolve(env.Expand(file)))
+			}
+		}
+	}
+
+	if config.Bin == "" {
+		return files, nil
+	}
+	for _, bin := range filepath.SplitList(config.Bin) {
+		bin = resolve(bin)
+		entries, err := ioutil.ReadDir(bin)
+		if os.IsNotExist(err) {
+			files = append(files, bin)
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("Could not list project bin directory %s: %s", bin, err)
+		}
+		for _, entry := range entries {
+			file := filepath.Join(bin, entry.Name())
+			if info, err := os.Stat(file); err != nil || !info.IsDir() {
+				files = append(files, file)
+			}
+		}
+	}
+
+	return files, nil
+}
+
+// ProjectConfigTrusted determines whether the project configuration, with its
+// current content, has been trusted.
+func ProjectConfigTrusted(config *ProjectConfig) (bool, error) {
+	trusted, err := loadTrustedProjectConfigs()
+	if err != nil {
+		return false, err
+	}
+	hash, err := ProjectConfigHash(config)
+	if err != nil {
+		return false, err
+	}
+
+	return trusted[config.Path] == hash, nil
+}
+
+// TrustProjectConfig records the current content of the project configuration
+// as trusted.
+func TrustProjectConfig(config *ProjectConfig) error {
+	trusted, err := loadTrustedProjectConfigs()
+	if err != nil {
+		return err
+	}
+	if trusted[config.Path], err = ProjectConfigHash(config); err != nil {
+		return err
+	}
+
+	return saveTrustedProjectConfigs(trusted)
+}
+
+// UntrustProjectConfig forgets the project configuration was trusted,
+// reporting whether it was.
+func UntrustProjectConfig(config *ProjectConfig) (bool, error) {
+	trusted, err := loadTrustedProjectConfigs()
+	if err != nil {
+		return false, err
+	}
+	if _, ok := trusted[config.Path]; !ok {
+		return false, nil
+	}
+	delete(trusted, config.Path)
+
+	return true, saveTrustedProjectConfigs(trusted)
+}
+
+// trustedProjectConfigsFile is the file in the rig state directory mapping the
+// path of each trusted project configuration to the hash of its content.
+func trustedProjectConfigsFile() (string, error) {
+	dir, err := util.StateDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "trusted-projects.json"), nil
+}
+
+// loadTrustedProjectConfigs reads the trusted project configurations, if any.
+func loadTrustedProjectConfigs() (map[string]string, error) {
+	trusted := map[string]string{}
+	file, err := trustedProjectConfigsFile()
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return trusted, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Could not read trusted project configurations: %s", err)
+	}
+	if err := json.Unmarshal(content, &trusted); err != nil {
+		return nil, fmt.Errorf("Could not read trusted project configurations from %s: %s", file, err)
+	}
+
+	return trusted, nil
+}
+
+// saveTrustedProjectConfigs writes the trusted project configurations, readable
+// only by the user.
+func saveTrustedProjectConfigs(trusted map[string]string) error {
+	file, err := trustedProjectConfigsFile()
+	if err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(trusted, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return fmt.Errorf("Could not create the rig state directory: %s", err)
+	}
+	if err := ioutil.WriteFile(file, content, 0600); err != nil {
+		return fmt.Errorf("Could not save trusted project configurations: %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli"
+)
+
+// ProjectValidate is the command for checking a project configuration file against its schema
+type ProjectValidate struct {
+	BaseCommand
+
+	// Reserved holds the built-in project subcommands scripts may not shadow.
+	Reserved []cli.Command
+}
+
+// Commands returns the operations supported by this command
+func (cmd *ProjectValidate) Commands() []cli.Command {
+	validate := cli.Command{
+		Name:        "validate",
+		Usage:       "Validate the project configuration file.",
+		ArgsUsage:   "[optional path to config file]",
+		Description: "Checks the Outrigger project configuration against the schema for its version, reporting every problem with its file, line and column. Exits with a non-zero code if any problems are found, making it suitable for pre-commit hooks.",
+		Before:      cmd.Before,
+		Action:      cmd.Run,
+	}
+
+	return []cli.Command{validate}
+}
+
+// Run executes the `rig project validate` command
+func (cmd *ProjectValidate) Run(ctx *cli.Context) error {
+	file := ctx.Args().First()
+	if file == "" {
+		var err error
+		if file, err = ProjectConfigFilePath(); err != nil {
+			return cmd.Failure(err.Error(), "PROJECT-CONFIG-NOT-FOUND", 12)
+		}
+	}
+
+	cmd.out.Verbose("Validating project configuration: %s", file)
+	config, err := NewProjectConfigFromFile(file)
+	problems, invalid := err.(ConfigErrors)
+	if mismatch, ok := err.(*RigVersionError); ok {
+		return cmd.Failure(mismatch.Error(), "RIG-VERSION-UNSUPPORTED", 12)
+	} else if err != nil && !invalid {
+		return cmd.Failure(fmt.Sprintf("Could not read project configuration %s: %s", file, err), "PROJECT-CONFIG-NOT-FOUND", 12)
+	} else if err == nil {
+		problems = config.CheckProjectScripts(cmd.Reserved)
+	}
+
+	if len(problems) > 0 {
+		for _, problem := range problems {
+			fmt.Fprintln(os.Stderr, problem)
+		}
+		return cmd.Failure(fmt.Sprintf("Project configuration %s has %d problem(s)", file, len(problems)), "PROJECT-CONFIG-INVALID", 12)
+	}
+
+	if LocalProjectConfigTracked(file) {
+		cmd.out.Warning("%s is tracked by git, but holds personal overrides. Remove it with 'git rm --cached' and add it to .gitignore", LocalProjectConfigFilePath(file))
+	}
+	cmd.out.Info("Project configuration %s is valid", file)
+	return cmd.Success("")
+}
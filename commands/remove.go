@@ -53,7 +53,7 @@ func (cmd *Remove) Run(c *cli.Context) error {
 	}
 
 	// Run kill first.
-	kill := Kill{cmd.BaseCommand}
+	kill := Kill{cmd.Nested()}
 	if err := kill.Run(c); err != nil {
 		return err
 	}
@@ -59,13 +59,20 @@ func (cmd *Start) Commands() []cli.Command {
 
 // Run executes the `rig start` command
 func (cmd *Start) Run(c *cli.Context) error {
-	if util.SupportsNativeDocker() {
-		cmd.out.Info("Linux users should use Docker natively for best performance.")
-		cmd.out.Info("Please ensure your local Docker setup is compatible with Outrigger.")
-		cmd.out.Info("See http://docs.outrigger.sh/getting-started/linux-installation/")
-		return cmd.StartMinimal(c.String("nameservers"))
-	}
+	return cmd.WithProjectHooks("start", func() error {
+		if util.SupportsNativeDocker() {
+			cmd.out.Info("Linux users should use Docker natively for best performance.")
+			cmd.out.Info("Please ensure your local Docker setup is compatible with Outrigger.")
+			cmd.out.Info("See http://docs.outrigger.sh/getting-started/linux-installation/")
+			return cmd.StartMinimal(c.String("nameservers"))
+		}
+
+		return cmd.StartOutrigger(c)
+	})
+}
 
+// StartOutrigger will create and start the Docker Machine and all Outrigger services.
+func (cmd *Start) StartOutrigger(c *cli.Context) error {
 	cmd.out.Spin(fmt.Sprintf("Starting Docker & Docker Machine (%s)", cmd.machine.Name))
 	cmd.out.Verbose("If something goes wrong, run 'rig doctor'")
 
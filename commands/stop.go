@@ -27,11 +27,13 @@ func (cmd *Stop) Commands() []cli.Command {
 
 // Run executes the `rig stop` command
 func (cmd *Stop) Run(c *cli.Context) error {
-	if util.SupportsNativeDocker() {
-		return cmd.StopMinimal()
-	}
+	return cmd.WithProjectHooks("stop", func() error {
+		if util.SupportsNativeDocker() {
+			return cmd.StopMinimal()
+		}
 
-	return cmd.StopOutrigger()
+		return cmd.StopOutrigger()
+	})
 }
 
 // StopMinimal will stop "minimal" Outrigger operations, which refers to environments where
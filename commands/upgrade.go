@@ -41,6 +41,14 @@ func (cmd *Upgrade) Commands() []cli.Command {
 
 // Run executes the `rig upgrade` command
 func (cmd *Upgrade) Run(c *cli.Context) error {
+	return cmd.WithProjectHooks("upgrade", func() error {
+		return cmd.upgrade(c)
+	})
+}
+
+// upgrade recreates the Docker Machine with the version of the local Docker
+// binary, keeping its data.
+func (cmd *Upgrade) upgrade(c *cli.Context) error {
 	if util.SupportsNativeDocker() {
 		return cmd.Success("Upgrade is not needed on Linux")
 	}
@@ -63,19 +71,19 @@ func (cmd *Upgrade) Run(c *cli.Context) error {
 	}
 
 	cmd.out.Info("Backing up to prepare for upgrade...")
-	backup := &DataBackup{cmd.BaseCommand}
+	backup := &DataBackup{cmd.Nested()}
 	if err := backup.Run(c); err != nil {
 		return err
 	}
 
-	remove := &Remove{cmd.BaseCommand}
+	remove := &Remove{cmd.Nested()}
 	removeCtx := cmd.NewContext(remove.Commands()[0].Name, remove.Commands()[0].Flags, c)
 	cmd.SetContextFlag(removeCtx, "force", strconv.FormatBool(true))
 	if err := remove.Run(removeCtx); err != nil {
 		return err
 	}
 
-	start := &Start{cmd.BaseCommand}
+	start := &Start{cmd.Nested()}
 	startCtx := cmd.NewContext(start.Commands()[0].Name, start.Commands()[0].Flags, c)
 	cmd.SetContextFlag(startCtx, "driver", cmd.machine.GetDriver())
 	cmd.SetContextFlag(startCtx, "cpu-count", strconv.FormatInt(int64(cmd.machine.GetCPU()), 10))
@@ -85,7 +93,7 @@ func (cmd *Upgrade) Run(c *cli.Context) error {
 		return err
 	}
 
-	restore := &DataRestore{cmd.BaseCommand}
+	restore := &DataRestore{cmd.Nested()}
 	restoreCtx := cmd.NewContext(restore.Commands()[0].Name, restore.Commands()[0].Flags, c)
 	cmd.SetContextFlag(restoreCtx, "data-dir", c.String("data-dir"))
 	backupFile := fmt.Sprintf("%s%c%s.tgz", c.String("backup-dir"), os.PathSeparator, cmd.machine.Name)
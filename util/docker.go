@@ -64,6 +64,25 @@ func ContainerRunning(name string) bool {
 	return false
 }
 
+// ComposeServiceRunning determines if a container of the docker-compose service
+// is live. The compose project is found from the directory and environment.
+func ComposeServiceRunning(service, dir string, env []string) bool {
+	/* #nosec */
+	cmd := exec.Command("docker-compose", "ps", "-q", service)
+	cmd.Dir = dir
+	cmd.Env = env
+	if out, err := Convert(cmd).Output(); err == nil {
+		for _, id := range strings.Fields(string(out)) {
+			/* #nosec */
+			if _, code, err := CaptureCommand(exec.Command("docker", "top", id)); code == 0 && err == nil {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
 // ImageOlderThan determines the age of the Docker Image and whether the image is older than the designated timestamp.
 func ImageOlderThan(image string, elapsedSeconds float64) (bool, float64, error) {
 	output, err := Command("docker", "inspect", "--format", "{{.Created}}", image).Output()
@@ -0,0 +1,108 @@
+package util
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Environment is a set of environment variables for a command, as used by
+// exec.Cmd.Env once converted with List.
+type Environment map[string]string
+
+// NewEnvironment creates an Environment from "KEY=value" pairs such as those
+// returned by os.Environ().
+func NewEnvironment(pairs []string) Environment {
+	env := Environment{}
+	for _, pair := range pairs {
+		if parts := strings.SplitN(pair, "=", 2); len(parts) == 2 {
+			env[parts[0]] = parts[1]
+		}
+	}
+
+	return env
+}
+
+// Expand replaces $VAR, ${VAR}, ${VAR:-default} and ${VAR-default} references
+// in value. With ':-' the default is also used when the variable is empty.
+func (e Environment) Expand(value string) string {
+	return os.Expand(value, func(name string) string {
+		if i := strings.Index(name, ":-"); i >= 0 {
+			if current := e[name[:i]]; current != "" {
+				return current
+			}
+			return e.Expand(name[i+2:])
+		} else if i := strings.Index(name, "-"); i >= 0 {
+			if current, ok := e[name[:i]]; ok {
+				return current
+			}
+			return e.Expand(name[i+1:])
+		}
+
+		return e[name]
+	})
+}
+
+// Merge sets every variable of the map after expanding its value. Values are
+// expanded against the environment as it was before the merge, so they may
+// not reference each other.
+func (e Environment) Merge(values map[string]string) {
+	expanded := map[string]string{}
+	for name, value := range values {
+		expanded[name] = e.Expand(value)
+	}
+	for name, value := range expanded {
+		e[name] = value
+	}
+}
+
+// LoadFile sets the variables declared in a dotenv style file. Each line holds
+// a KEY=value pair, optionally preceded by 'export'. Blank lines and lines
+// starting with # are skipped. Values in single quotes are taken literally,
+// others are expanded and may reference variables set on earlier lines.
+func (e Environment) LoadFile(file string) error {
+	handle, err := os.Open(file) // nolint: gosec
+	if err != nil {
+		return err
+	}
+	defer handle.Close() // nolint: errcheck
+
+	scanner := bufio.NewScanner(handle)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+
+		parts := strings.SplitN(line, "=", 2)
+		name := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || name == "" || strings.ContainsAny(name, " \t") {
+			return fmt.Errorf("%s:%d: expected KEY=value, found '%s'", file, number, line)
+		}
+
+		value := strings.TrimSpace(parts[1])
+		if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+			e[name] = value[1 : len(value)-1]
+			continue
+		} else if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			value = value[1 : len(value)-1]
+		}
+		e[name] = e.Expand(value)
+	}
+
+	return scanner.Err()
+}
+
+// List returns the environment as sorted "KEY=value" pairs.
+func (e Environment) List() []string {
+	pairs := []string{}
+	for name, value := range e {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+
+	return pairs
+}
@@ -0,0 +1,62 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEnvironmentExpand(t *testing.T) {
+	env := Environment{"HOST": "db", "EMPTY": ""}
+	cases := map[string]string{
+		"$HOST:3306":                "db:3306",
+		"${HOST}/data":              "db/data",
+		"${PORT:-3306}":             "3306",
+		"${EMPTY:-fallback}":        "fallback",
+		"${EMPTY-fallback}":         "",
+		"${MISSING-$HOST}":          "db",
+		"${HOST:-localhost}/${DB}x": "db/x",
+	}
+	for value, expected := range cases {
+		if actual := env.Expand(value); actual != expected {
+			t.Errorf("expanding '%s': expected '%s', found '%s'", value, expected, actual)
+		}
+	}
+}
+
+func TestEnvironmentLoadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rig-env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, ".env")
+	content := `# Database settings
+export DB_HOST=db
+DB_URL="mysql://${DB_USER:-root}@$DB_HOST"
+LITERAL='$DB_HOST'
+
+`
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	env := Environment{}
+	if err := env.LoadFile(file); err != nil {
+		t.Fatal(err)
+	}
+	expected := Environment{"DB_HOST": "db", "DB_URL": "mysql://root@db", "LITERAL": "$DB_HOST"}
+	if !reflect.DeepEqual(env, expected) {
+		t.Errorf("expected %v, found %v", expected, env)
+	}
+
+	if err := ioutil.WriteFile(file, []byte("VALID=1\nnot valid\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.LoadFile(file); err == nil || err.Error() != file+":2: expected KEY=value, found 'not valid'" {
+		t.Errorf("expected a problem on line 2, found: %v", err)
+	}
+}
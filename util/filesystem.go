@@ -1,6 +1,7 @@
 package util
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -13,6 +14,24 @@ func GetExecutableDir() (string, error) {
 	return osext.ExecutableFolder()
 }
 
+// StateDir returns the directory rig keeps its state in between runs. This is
+// ~/.rig unless $RIG_STATE_DIR is set.
+func StateDir() (string, error) {
+	if dir := os.Getenv("RIG_STATE_DIR"); dir != "" {
+		return dir, nil
+	}
+
+	home := os.Getenv("HOME")
+	if home == "" && IsWindows() {
+		home = os.Getenv("USERPROFILE")
+	}
+	if home == "" {
+		return "", errors.New("could not find the home directory to keep rig state in")
+	}
+
+	return filepath.Join(home, ".rig"), nil
+}
+
 // AbsJoin joins the two path segments, ensuring they form an absolute path.
 func AbsJoin(baseDir, suffixPath string) (string, error) {
 	if len(baseDir) == 0 {
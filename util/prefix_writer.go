@@ -0,0 +1,60 @@
+package util
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// PrefixWriter writes each line of output preceded by a prefix, such as the
+// name of the process that produced it. Writers that share a destination
+// should share a lock so their lines are never interleaved.
+type PrefixWriter struct {
+	out    io.Writer
+	prefix []byte
+	lock   *sync.Mutex
+	buffer bytes.Buffer
+}
+
+// NewPrefixWriter creates a PrefixWriter for the destination.
+func NewPrefixWriter(out io.Writer, prefix string, lock *sync.Mutex) *PrefixWriter {
+	return &PrefixWriter{
+		out:    out,
+		prefix: []byte(prefix),
+		lock:   lock,
+	}
+}
+
+// Write buffers the output and writes every completed line.
+func (w *PrefixWriter) Write(p []byte) (int, error) {
+	w.buffer.Write(p) // nolint: gosec
+	for {
+		index := bytes.IndexByte(w.buffer.Bytes(), '\n')
+		if index < 0 {
+			break
+		}
+		if err := w.writeLine(w.buffer.Next(index + 1)); err != nil {
+			return len(p), err
+		}
+	}
+
+	return len(p), nil
+}
+
+// Flush writes any trailing output that did not end with a newline.
+func (w *PrefixWriter) Flush() error {
+	if w.buffer.Len() == 0 {
+		return nil
+	}
+
+	return w.writeLine(append(w.buffer.Next(w.buffer.Len()), '\n'))
+}
+
+// writeLine writes a single prefixed line to the destination.
+func (w *PrefixWriter) writeLine(line []byte) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	_, err := w.out.Write(append(append([]byte{}, w.prefix...), line...))
+	return err
+}
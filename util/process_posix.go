@@ -0,0 +1,70 @@
+//go:build !windows
+// +build !windows
+
+package util
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// SetProcessGroup configures a command to start in its own process group so
+// that it can be terminated along with every process it spawns.
+func SetProcessGroup(cmd *exec.Cmd) {
+	processAttributes(cmd).Setpgid = true
+}
+
+// SetCommandLine passes the command line to the program as written on
+// Windows. Programs on other systems receive the arguments of the command.
+func SetCommandLine(cmd *exec.Cmd, line string) {}
+
+// processAttributes retrieves the system attributes of a command, creating
+// them if need be so settings made for other purposes are kept.
+func processAttributes(cmd *exec.Cmd) *syscall.SysProcAttr {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+
+	return cmd.SysProcAttr
+}
+
+// KillProcessGroup terminates a started command and every process in its group.
+func KillProcessGroup(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// DetachProcess configures a command to start in its own session so that it
+// keeps running after rig and its terminal exit.
+func DetachProcess(cmd *exec.Cmd) {
+	processAttributes(cmd).Setsid = true
+}
+
+// ProcessRunning determines whether a process with the id is running.
+func ProcessRunning(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// TerminateProcess asks a process to exit.
+func TerminateProcess(pid int) error {
+	return syscall.Kill(pid, syscall.SIGTERM)
+}
+
+// ProcessCommandLine retrieves the command line of a running process, with its
+// arguments separated by spaces.
+func ProcessCommandLine(pid int) (string, error) {
+	if content, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/cmdline"); err == nil {
+		return strings.TrimSpace(string(bytes.Replace(content, []byte{0}, []byte{' '}, -1))), nil
+	}
+
+	/* #nosec */
+	output, err := exec.Command("ps", "-o", "args=", "-p", strconv.Itoa(pid)).Output()
+	return strings.TrimSpace(string(output)), err
+}
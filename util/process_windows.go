@@ -0,0 +1,71 @@
+package util
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// SetProcessGroup configures a command to start in its own process group so
+// that it can be terminated along with every process it spawns.
+func SetProcessGroup(cmd *exec.Cmd) {
+	processAttributes(cmd).CreationFlags |= syscall.CREATE_NEW_PROCESS_GROUP
+}
+
+// SetCommandLine passes the command line to the program as written, rather
+// than quoting each argument of the command. This is needed by cmd, which
+// does not split its command line the way other programs do.
+func SetCommandLine(cmd *exec.Cmd, line string) {
+	processAttributes(cmd).CmdLine = line
+}
+
+// processAttributes retrieves the system attributes of a command, creating
+// them if need be so settings made for other purposes are kept.
+func processAttributes(cmd *exec.Cmd) *syscall.SysProcAttr {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+
+	return cmd.SysProcAttr
+}
+
+// KillProcessGroup terminates a started command and every process in its tree.
+func KillProcessGroup(cmd *exec.Cmd) error {
+	/* #nosec */
+	return exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run()
+}
+
+// detachedProcess starts a process without a console, see
+// https://docs.microsoft.com/en-us/windows/desktop/ProcThread/process-creation-flags
+const detachedProcess = 0x00000008
+
+// DetachProcess configures a command to start without a console so that it
+// keeps running after rig and its terminal exit.
+func DetachProcess(cmd *exec.Cmd) {
+	processAttributes(cmd).CreationFlags |= syscall.CREATE_NEW_PROCESS_GROUP | detachedProcess
+}
+
+// ProcessRunning determines whether a process with the id is running.
+func ProcessRunning(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	/* #nosec */
+	output, err := exec.Command("tasklist", "/FI", "PID eq "+strconv.Itoa(pid), "/NH").Output()
+	return err == nil && strings.Contains(string(output), " "+strconv.Itoa(pid)+" ")
+}
+
+// TerminateProcess ends a process and every process in its tree.
+func TerminateProcess(pid int) error {
+	/* #nosec */
+	return exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(pid)).Run()
+}
+
+// ProcessCommandLine retrieves the command line of a running process.
+func ProcessCommandLine(pid int) (string, error) {
+	/* #nosec */
+	output, err := exec.Command("powershell", "-NoProfile", "-Command", fmt.Sprintf("(Get-CimInstance Win32_Process -Filter 'ProcessId=%d').CommandLine", pid)).Output()
+	return strings.TrimSpace(string(output)), err
+}
@@ -1,14 +1,21 @@
 package util
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"os/signal"
+	"regexp"
 	"strings"
 	"syscall"
+	"time"
+	"unicode"
 
 	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
 )
 
 const defaultFailedCode = 1
@@ -52,33 +59,82 @@ func EscalatePrivilege() error {
 // native execution of the command passed to it.
 //
 // Derived from: http://stackoverflow.com/a/40770011/38408
-func PassthruCommand(cmd *exec.Cmd) (exitCode int) {
+func PassthruCommand(cmd *exec.Cmd) int {
 	cmd.Stderr = os.Stderr
 	cmd.Stdout = os.Stdout
 	cmd.Stdin = os.Stdin
 
 	bin := Convert(cmd)
-	err := bin.Run()
+	return ExitStatus(cmd, bin.Run())
+}
 
-	if err != nil {
-		// Try to get the exit code.
-		if exitError, ok := err.(*exec.ExitError); ok {
-			ws := exitError.Sys().(syscall.WaitStatus)
-			exitCode = ws.ExitStatus()
-		} else {
-			// This will happen (in OSX) if `name` is not available in $PATH,
-			// in this situation, exit code could not be get, and stderr will be
-			// empty string very likely, so we use the default fail code, and format err
-			// to string and set to stderr
-			exitCode = defaultFailedCode
-		}
-	} else {
-		// Success, exitCode should be 0.
-		ws := cmd.ProcessState.Sys().(syscall.WaitStatus)
-		exitCode = ws.ExitStatus()
+// Reasons a command run by RunCommandTimeout was terminated.
+var (
+	ErrCommandTimeout     = errors.New("timed out")
+	ErrCommandStopped     = errors.New("stopped")
+	ErrCommandInterrupted = errors.New("interrupted")
+)
+
+// PassthruCommandTimeout is similar to PassthruCommand but terminates the
+// command and every process it started once the timeout elapses. The command
+// runs in its own process group, so it is not given an interactive terminal
+// as input. A zero timeout means no limit.
+func PassthruCommandTimeout(cmd *exec.Cmd, timeout time.Duration) (int, error) {
+	cmd.Stderr = os.Stderr
+	cmd.Stdout = os.Stdout
+	if !StdinIsTerminal() {
+		cmd.Stdin = os.Stdin
 	}
 
-	return
+	return RunCommandTimeout(cmd, timeout, nil)
+}
+
+// RunCommandTimeout runs a command in its own process group. The group is
+// terminated when the timeout elapses, when the stop channel is closed or
+// when rig is interrupted, which is reported as ErrCommandTimeout,
+// ErrCommandStopped or ErrCommandInterrupted along with the exit status.
+func RunCommandTimeout(cmd *exec.Cmd, timeout time.Duration, stop <-chan struct{}) (int, error) {
+	SetProcessGroup(cmd)
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	if err := Convert(cmd).Start(); err != nil {
+		return ExitStatus(cmd, err), err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	var reason error
+	terminate := func(why error) {
+		if reason == nil {
+			reason = why
+			KillProcessGroup(cmd) // nolint: gosec
+		}
+	}
+	for {
+		select {
+		case err := <-done:
+			return ExitStatus(cmd, err), reason
+		case <-expired:
+			terminate(ErrCommandTimeout)
+		case <-stop:
+			terminate(ErrCommandStopped)
+			stop = nil
+		case <-interrupts:
+			terminate(ErrCommandInterrupted)
+		}
+	}
 }
 
 // CaptureCommand is similar to PassthruCommand except it intercepts all output.
@@ -90,26 +146,152 @@ func CaptureCommand(cmd *exec.Cmd) (string, int, error) {
 
 	result, err := bin.Output()
 
-	var exitCode int
+	return string(result), ExitStatus(cmd, err), err
+}
+
+// ExitStatus determines the exit code of a command from the error returned
+// by running or waiting on it.
+//
+// Derived from: http://stackoverflow.com/a/40770011/38408
+func ExitStatus(cmd *exec.Cmd, err error) int {
 	if err != nil {
 		// Try to get the exit code.
 		if exitError, ok := err.(*exec.ExitError); ok {
 			ws := exitError.Sys().(syscall.WaitStatus)
-			exitCode = ws.ExitStatus()
-		} else {
-			// This will happen (in OSX) if `name` is not available in $PATH,
-			// in this situation, exit code could not be get, and stderr will be
-			// empty string very likely, so we use the default fail code, and format err
-			// to string and set to stderr
-			exitCode = defaultFailedCode
+			return ws.ExitStatus()
 		}
-	} else {
-		// Success, exitCode should be 0.
-		ws := cmd.ProcessState.Sys().(syscall.WaitStatus)
-		exitCode = ws.ExitStatus()
+
+		// This will happen (in OSX) if `name` is not available in $PATH,
+		// in this situation, exit code could not be get, and stderr will be
+		// empty string very likely, so we use the default fail code, and format err
+		// to string and set to stderr
+		return defaultFailedCode
+	}
+
+	// Success, exitCode should be 0.
+	ws := cmd.ProcessState.Sys().(syscall.WaitStatus)
+	return ws.ExitStatus()
+}
+
+// StdinIsTerminal determines if input comes from an interactive terminal.
+func StdinIsTerminal() bool {
+	return isatty.IsTerminal(os.Stdin.Fd()) || isatty.IsCygwinTerminal(os.Stdin.Fd())
+}
+
+// safeShellArg matches arguments that need no quoting in a shell command.
+var safeShellArg = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// QuoteShellArg quotes a value so it is passed as a single argument by the
+// shell used for project scripts: sh on POSIX systems and cmd on Windows.
+func QuoteShellArg(value string) string {
+	if IsWindows() {
+		return QuoteWindowsShellArg(value)
+	}
+
+	return QuotePosixShellArg(value)
+}
+
+// QuotePosixShellArg quotes a value so it is passed as a single argument by
+// sh and compatible shells such as bash and zsh.
+func QuotePosixShellArg(value string) string {
+	if safeShellArg.MatchString(value) {
+		return value
+	}
+
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
+
+// safeWindowsShellArg matches arguments that need no quoting in a command run
+// by cmd, which expands %VAR% references.
+var safeWindowsShellArg = regexp.MustCompile(`^[A-Za-z0-9_@+=:,./\\-]+$`)
+
+// windowsShellMetacharacters matches the characters cmd interprets itself,
+// which are escaped with a caret.
+var windowsShellMetacharacters = regexp.MustCompile(`[()%!^"<>&|]`)
+
+// QuoteWindowsShellArg quotes a value so it is passed as a single argument by
+// cmd on Windows. The value is quoted as programs split their command line,
+// then the characters cmd would act on, including the quotes and the % of
+// variable references, are escaped with ^. The command line must reach cmd as
+// written, see SetCommandLine.
+func QuoteWindowsShellArg(value string) string {
+	if safeWindowsShellArg.MatchString(value) {
+		return value
+	}
+
+	return windowsShellMetacharacters.ReplaceAllString(quoteWindowsArg(value), "^$0")
+}
+
+// quoteWindowsArg quotes a value as a single argument of a Windows command
+// line, doubling the backslashes that precede a quote or the closing quote.
+func quoteWindowsArg(value string) string {
+	var quoted bytes.Buffer
+	quoted.WriteByte('"')
+	slashes := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			slashes++
+		case '"':
+			quoted.WriteString(strings.Repeat(`\`, slashes+1))
+			slashes = 0
+		default:
+			slashes = 0
+		}
+		quoted.WriteByte(value[i])
+	}
+	quoted.WriteString(strings.Repeat(`\`, slashes))
+	quoted.WriteByte('"')
+
+	return quoted.String()
+}
+
+// SplitShellArgs splits a command line into arguments on whitespace, honoring
+// single and double quotes and backslash escapes, without any expansion. It
+// accepts the quoting produced by QuotePosixShellArg.
+func SplitShellArgs(line string) ([]string, error) {
+	args := []string{}
+	var current []rune
+	inArg, escaped := false, false
+	var quote rune
+	for _, r := range line {
+		switch {
+		case escaped:
+			current, escaped = append(current, r), false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				current = append(current, r)
+			}
+		case r == '\\':
+			inArg, escaped = true, true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				current = append(current, r)
+			}
+		case r == '\'' || r == '"':
+			inArg, quote = true, r
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, string(current))
+				current, inArg = nil, false
+			}
+		default:
+			inArg, current = true, append(current, r)
+		}
+	}
+
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in: %s", line)
+	}
+	if inArg {
+		args = append(args, string(current))
 	}
 
-	return string(result), exitCode, err
+	return args, nil
 }
 
 // Execute executes the provided command, it also can specify if the output should be forced to print to the console
@@ -0,0 +1,44 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitShellArgs(t *testing.T) {
+	args, err := SplitShellArgs(`--who "big world" it\'s  '$HOME' ""`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"--who", "big world", "it's", "$HOME", ""}; !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected %q, found %q", expected, args)
+	}
+
+	values := []string{"plain", "two words", "it's", `say "hi"`}
+	line := ""
+	for _, value := range values {
+		line += QuotePosixShellArg(value) + " "
+	}
+	if args, err = SplitShellArgs(line); err != nil || !reflect.DeepEqual(args, values) {
+		t.Errorf("expected quoted values to split into %q, found %q (%v)", values, args, err)
+	}
+
+	if _, err = SplitShellArgs(`--who "unterminated`); err == nil {
+		t.Error("expected an unterminated quote to be rejected")
+	}
+}
+
+func TestQuoteWindowsShellArg(t *testing.T) {
+	cases := map[string]string{
+		`C:\Users\rig`:           `C:\Users\rig`,
+		`say "hi" & echo %PATH%`: `^"say \^"hi\^" ^& echo ^%PATH^%^"`,
+		`two words\`:             `^"two words\\^"`,
+		`a\"b`:                   `^"a\\\^"b^"`,
+		"50%":                    `^"50^%^"`,
+	}
+	for value, expected := range cases {
+		if quoted := QuoteWindowsShellArg(value); quoted != expected {
+			t.Errorf("expected %s to be quoted as %s, found %s", value, expected, quoted)
+		}
+	}
+}